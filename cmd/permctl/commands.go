@@ -0,0 +1,155 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/permsearch"
+)
+
+func grant(args []string) error {
+	fs, opts := newFlagSet("grant")
+	kind := fs.String("kind", "", "resource kind")
+	resource := fs.String("resource", "", "resource id")
+	user := fs.String("user", "", "user id")
+	group := fs.String("group", "", "group name")
+	right := fs.String("right", "", "right, combination of r, w, x and a, or role name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return opts.execute([]model.Command{{Command: model.CommandPut, Kind: *kind, Resource: *resource, User: *user, Group: *group, Right: *right}})
+}
+
+func revoke(args []string) error {
+	fs, opts := newFlagSet("revoke")
+	kind := fs.String("kind", "", "resource kind")
+	resource := fs.String("resource", "", "resource id")
+	user := fs.String("user", "", "user id")
+	group := fs.String("group", "", "group name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return opts.execute([]model.Command{{Command: model.CommandDelete, Kind: *kind, Resource: *resource, User: *user, Group: *group}})
+}
+
+func copyRights(args []string) error {
+	fs, opts := newFlagSet("copy")
+	kind := fs.String("kind", "", "resource kind of the source")
+	from := fs.String("from", "", "source resource id")
+	toKind := fs.String("to-kind", "", "resource kind of the target (default -kind)")
+	to := fs.String("to", "", "target resource id")
+	prune := fs.Bool("prune", false, "remove rights of the target which the source does not have")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *toKind == "" {
+		*toKind = *kind
+	}
+	token, err := opts.parseToken()
+	if err != nil {
+		return err
+	}
+	lookup := opts.currentRights(token)
+	if lookup == nil {
+		return errors.New("copy needs -search-url and -token to read the rights of the source")
+	}
+	source, err := lookup(*kind, *from)
+	if err != nil {
+		return err
+	}
+	target, err := lookup(*toKind, *to)
+	if err != nil {
+		return err
+	}
+	commands := []model.Command{}
+	for _, user := range sortedKeys(source.UserRights) {
+		commands = append(commands, model.Command{Command: model.CommandPut, Kind: *toKind, Resource: *to, User: user, Right: source.UserRights[user].String()})
+	}
+	for _, group := range sortedKeys(source.GroupRights) {
+		commands = append(commands, model.Command{Command: model.CommandPut, Kind: *toKind, Resource: *to, Group: group, Right: source.GroupRights[group].String()})
+	}
+	if *prune {
+		for _, user := range sortedKeys(target.UserRights) {
+			if _, ok := source.UserRights[user]; !ok {
+				commands = append(commands, model.Command{Command: model.CommandDelete, Kind: *toKind, Resource: *to, User: user})
+			}
+		}
+		for _, group := range sortedKeys(target.GroupRights) {
+			if _, ok := source.GroupRights[group]; !ok {
+				commands = append(commands, model.Command{Command: model.CommandDelete, Kind: *toKind, Resource: *to, Group: group})
+			}
+		}
+	}
+	if len(commands) == 0 {
+		fmt.Println("source has no rights, nothing to copy")
+		return nil
+	}
+	return opts.execute(commands)
+}
+
+func list(args []string) error {
+	fs, opts := newFlagSet("list")
+	kind := fs.String("kind", "", "resource kind")
+	resource := fs.String("resource", "", "resource id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	token, err := opts.parseToken()
+	if err != nil {
+		return err
+	}
+	lookup := opts.currentRights(token)
+	if lookup == nil {
+		return errors.New("list needs -search-url and -token")
+	}
+	rights, err := lookup(*kind, *resource)
+	if err != nil {
+		return err
+	}
+	printRights(os.Stdout, rights)
+	return nil
+}
+
+func apply(args []string) error {
+	fs, opts := newFlagSet("apply")
+	file := fs.String("file", "", "csv (.csv), json lines (.jsonl) or yaml (.yaml, .yml) file with the columns/fields command, kind, resource, user, group, right")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	commands, err := readCommandFile(*file)
+	if err != nil {
+		return err
+	}
+	if len(commands) == 0 {
+		fmt.Println("no commands in", *file)
+		return nil
+	}
+	return opts.execute(commands)
+}
+
+func sortedKeys(m map[string]permsearch.Right) (result []string) {
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/permsearch"
+)
+
+// rightsLookup returns the current rights of a resource; a nil lookup means the current state is unknown
+type rightsLookup func(kind string, resource string) (*permsearch.ResourceRights, error)
+
+// printDiff prints one line per command, grouped by resource:
+// '+' adds a principal, '~' changes its right, '-' removes it, '=' leaves it unchanged
+func printDiff(out io.Writer, commands []model.Command, lookup rightsLookup) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	lastResource := ""
+	for _, command := range commands {
+		resource := command.Kind + " " + command.Resource
+		if resource != lastResource {
+			fmt.Fprintln(w, resource)
+			lastResource = resource
+		}
+		principalType, principal := "user", command.User
+		if command.Group != "" {
+			principalType, principal = "group", command.Group
+		}
+		before, known := "?", false
+		if lookup != nil {
+			rights, err := lookup(command.Kind, command.Resource)
+			if err != nil {
+				fmt.Fprintf(w, "  !\t%v\t%v\tunable to read current rights: %v\n", principalType, principal, err)
+			} else {
+				known = true
+				before = currentRight(rights, command)
+			}
+		}
+		after := ""
+		if command.Command == model.CommandPut {
+			after = permsearch.ParseRight(command.Right).String()
+		}
+		switch {
+		case known && before == after:
+			fmt.Fprintf(w, "  =\t%v\t%v\t%v\n", principalType, principal, display(after))
+		case known && before == "":
+			fmt.Fprintf(w, "  +\t%v\t%v\t%v\n", principalType, principal, display(after))
+		case after == "":
+			fmt.Fprintf(w, "  -\t%v\t%v\t%v -> (none)\n", principalType, principal, display(before))
+		default:
+			fmt.Fprintf(w, "  ~\t%v\t%v\t%v -> %v\n", principalType, principal, display(before), after)
+		}
+	}
+}
+
+func currentRight(rights *permsearch.ResourceRights, command model.Command) string {
+	if rights == nil {
+		return ""
+	}
+	if command.User != "" {
+		return rights.UserRights[command.User].String()
+	}
+	return rights.GroupRights[command.Group].String()
+}
+
+func display(right string) string {
+	if right == "" {
+		return "(none)"
+	}
+	return right
+}
+
+func printRights(out io.Writer, rights *permsearch.ResourceRights) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "TYPE\tNAME\tRIGHT")
+	if rights == nil {
+		return
+	}
+	for _, user := range sortedKeys(rights.UserRights) {
+		fmt.Fprintf(w, "user\t%v\t%v\n", user, rights.UserRights[user].String())
+	}
+	for _, group := range sortedKeys(rights.GroupRights) {
+		fmt.Fprintf(w, "group\t%v\t%v\n", group, rights.GroupRights[group].String())
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/SENERGY-Platform/permission-command/lib/commandfile"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+func readCommandFile(location string) (commands []model.Command, err error) {
+	if location == "" {
+		return nil, errors.New("missing -file")
+	}
+	format, err := commandfile.FormatOf(location)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(location)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return commandfile.Read(file, format)
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// permctl administrates permissions through the permission-command http api
+// or, in break-glass mode (-kafka), by publishing permission commands directly to kafka.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: permctl <command> [flags]
+
+commands:
+  grant   set the right of a user or group for a resource
+  revoke  remove a user or group from a resource
+  copy    copy all rights of a resource to another resource
+  list    list the rights of a resource (reads permission-search)
+  apply   apply the commands of a csv or yaml file
+
+run 'permctl <command> -h' for the flags of a command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	commands := map[string]func(args []string) error{
+		"grant":  grant,
+		"revoke": revoke,
+		"copy":   copyRights,
+		"list":   list,
+		"apply":  apply,
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	err := command(os.Args[2:])
+	if err == flag.ErrHelp {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		os.Exit(1)
+	}
+}
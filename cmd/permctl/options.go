@@ -0,0 +1,221 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SENERGY-Platform/permission-command/lib"
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/client"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/permsearch"
+	"github.com/SENERGY-Platform/permission-command/lib/roles"
+)
+
+type options struct {
+	url       string
+	token     string
+	searchUrl string
+	kafka     bool
+	config    string
+	tenant    string
+	dryRun    bool
+
+	configLoaded bool
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet("permctl "+name, flag.ContinueOnError)
+	opts := &options{}
+	fs.StringVar(&opts.url, "url", os.Getenv("PERMCTL_URL"), "permission-command url (env PERMCTL_URL)")
+	fs.StringVar(&opts.token, "token", os.Getenv("PERMCTL_TOKEN"), "authorization token (env PERMCTL_TOKEN)")
+	fs.StringVar(&opts.searchUrl, "search-url", os.Getenv("PERMCTL_SEARCH_URL"), "permission-search url used to read current rights (env PERMCTL_SEARCH_URL)")
+	fs.BoolVar(&opts.kafka, "kafka", false, "break-glass mode: publish commands directly to kafka using the service configuration")
+	fs.StringVar(&opts.config, "config", "config.json", "service configuration file used in break-glass mode")
+	fs.StringVar(&opts.tenant, "tenant", "", "tenant of the anonymous admin in break-glass mode, required if the configuration has Tenants")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "print the changes without applying them")
+	return fs, opts
+}
+
+// parseToken returns the parsed -token; in break-glass mode a missing token is replaced by an anonymous admin of -tenant
+func (this *options) parseToken() (token auth.Token, err error) {
+	err = this.loadConfig()
+	if err != nil {
+		return token, err
+	}
+	if this.token == "" && this.kafka {
+		return lib.AnonymousAdmin("permctl", this.tenant)
+	}
+	if this.token == "" {
+		return token, errors.New("missing -token")
+	}
+	return auth.Parse(this.token)
+}
+
+// execute prints the diff of the commands and applies them unless -dry-run is set
+func (this *options) execute(commands []model.Command) error {
+	token, err := this.parseToken()
+	if err != nil {
+		return err
+	}
+	commands, err = this.expandRoles(token, commands)
+	if err != nil {
+		return err
+	}
+	for i, command := range commands {
+		err = lib.ValidateModelCommand(command)
+		if err == nil {
+			err = lib.CheckCommand(token, lib.CommandFromModel(command))
+		}
+		if err != nil {
+			return fmt.Errorf("command %v: %w", i, err)
+		}
+	}
+	printDiff(os.Stdout, commands, this.currentRights(token))
+	if this.dryRun {
+		fmt.Println("dry run: nothing applied")
+		return nil
+	}
+	if this.kafka {
+		err = this.publish(token, commands)
+	} else {
+		err = this.send(token, commands)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("applied %v commands\n", len(commands))
+	return nil
+}
+
+// expandRoles replaces role names by their right strings, using the roles of the service configuration
+// in break-glass mode and those of GET /roles otherwise
+func (this *options) expandRoles(token auth.Token, commands []model.Command) ([]model.Command, error) {
+	expand := lib.GetRoles().Expand
+	if !this.kafka {
+		expand = this.remoteRoles(token).Expand
+	}
+	result := []model.Command{}
+	for i, command := range commands {
+		if command.Command == model.CommandPut {
+			right, err := expand(command.Kind, command.Right)
+			if err != nil {
+				return nil, fmt.Errorf("command %v: %w", i, err)
+			}
+			command.Right = right
+		}
+		result = append(result, command)
+	}
+	return result, nil
+}
+
+// remoteRoles reads the roles of the kinds of role names from -url
+type remoteRoles struct {
+	options *options
+	token   auth.Token
+	known   roles.Config
+}
+
+func (this *options) remoteRoles(token auth.Token) *remoteRoles {
+	return &remoteRoles{options: this, token: token, known: roles.Config{}}
+}
+
+func (this *remoteRoles) Expand(kind string, right string) (string, error) {
+	if roles.IsRight(right) {
+		return right, nil
+	}
+	if _, ok := this.known[kind]; !ok {
+		if this.options.url == "" {
+			return "", errors.New("missing -url to read the role " + right)
+		}
+		list, err := client.New(this.options.url, client.WithToken(this.token.Token)).Roles(context.Background(), kind)
+		if err != nil {
+			return "", err
+		}
+		this.known[kind] = map[string]string{}
+		for _, role := range list {
+			this.known[kind][role.Name] = role.Right
+		}
+	}
+	return this.known.Expand(kind, right)
+}
+
+func (this *options) send(token auth.Token, commands []model.Command) error {
+	if this.url == "" {
+		return errors.New("missing -url")
+	}
+	return client.New(this.url, client.WithToken(token.Token)).Batch(context.Background(), commands)
+}
+
+// loadConfig reads the service configuration in break-glass mode; it has to run before tokens and commands are checked,
+// because the policy, roles and tenants of the configuration are read only once
+func (this *options) loadConfig() error {
+	if !this.kafka || this.configLoaded {
+		return nil
+	}
+	err := lib.LoadConfig(this.config)
+	this.configLoaded = err == nil
+	return err
+}
+
+// publish writes the commands to the topics of the tenant of token
+func (this *options) publish(token auth.Token, commands []model.Command) error {
+	publisher, err := lib.NewPublisher()
+	if err != nil {
+		return err
+	}
+	defer publisher.Close()
+	for i, command := range commands {
+		topic, err := lib.TopicForToken(token, command.Kind)
+		if err == nil {
+			err = publisher.PublishTo(context.Background(), topic, lib.CommandFromModel(command))
+		}
+		if err != nil {
+			return fmt.Errorf("published %v of %v commands: %w", i, len(commands), err)
+		}
+	}
+	return nil
+}
+
+// currentRights returns a lookup of the current rights or nil if permission-search is not configured
+func (this *options) currentRights(token auth.Token) rightsLookup {
+	if this.searchUrl == "" || token.Token == "" {
+		return nil
+	}
+	search := permsearch.New(this.searchUrl)
+	cache := map[string]*permsearch.ResourceRights{}
+	return func(kind string, resource string) (*permsearch.ResourceRights, error) {
+		key := kind + "/" + resource
+		if rights, ok := cache[key]; ok {
+			return rights, nil
+		}
+		rights, err := search.GetRights(token.Token, kind, resource)
+		if errors.Is(err, permsearch.ErrNotFound) {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		cache[key] = &rights
+		return &rights, nil
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/commandfile"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/projection"
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
+)
+
+const importProgressInterval = 100
+
+// ImportProgress is streamed as json lines while an import is published
+type ImportProgress struct {
+	Status    string           `json:"status"` //validated | publishing | done | failed
+	Published int              `json:"published"`
+	Total     int              `json:"total"`
+	Error     *problem.Problem `json:"error,omitempty"`
+}
+
+// getTenantAdminToken returns a problem if the request has no token with the admin realm role of its tenant
+func getTenantAdminToken(r *http.Request) (token auth.Token, err error) {
+	token, err = auth.GetParsedToken(r)
+	if err != nil {
+		return token, problem.New(http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
+	}
+	if !isAdmin(token) {
+		return token, problem.New(http.StatusForbidden, problem.AdminRoleRequired, "only tokens with the admin role may use this endpoint")
+	}
+	return token, nil
+}
+
+// ReplayGrants returns all current rights of the permission topics of the tenant.
+// The local projection is used if enabled and the tenant uses the default topics,
+// otherwise the topics are replayed into a temporary projection.
+func ReplayGrants(ctx context.Context, t tenant.Tenant) ([]model.Command, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	p, err := replay(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return p.Grants(), nil
+}
+
+// replay returns the synced local projection or a temporary projection of the topics of the tenant,
+// which keeps applying new commands until ctx is canceled
+func replay(ctx context.Context, t tenant.Tenant) (*projection.Projection, error) {
+	if localProjection != nil && t.UsesDefaultTopics() {
+		return getSyncedProjection()
+	}
+	consumerConfig, err := getProjectionConsumerConfig(tenantTopics(t))
+	if err != nil {
+		return nil, replayProblem(err)
+	}
+	temp := projection.New()
+	err = temp.Start(ctx, consumerConfig)
+	if err != nil {
+		return nil, replayProblem(err)
+	}
+	err = temp.WaitForSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return temp, nil
+}
+
+func replayProblem(err error) problem.Problem {
+	p := problem.Wrap(http.StatusBadGateway, problem.Internal, err)
+	p.Detail = "unable to replay the permission topic"
+	return p
+}
+
+func handleExport(res http.ResponseWriter, r *http.Request) {
+	token, err := getTenantAdminToken(r)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	t, err := getTenant(token)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	format := commandfile.Jsonl
+	contentType := "application/x-ndjson"
+	if r.URL.Query().Get("format") == string(commandfile.Csv) {
+		format = commandfile.Csv
+		contentType = "text/csv"
+	}
+	grants, err := ReplayGrants(r.Context(), t)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	res.Header().Set("Content-Type", contentType)
+	writer, err := commandfile.NewWriter(res, format)
+	if err != nil {
+		return
+	}
+	for _, grant := range grants {
+		if writer.Write(grant) != nil {
+			return
+		}
+	}
+	writer.Flush()
+}
+
+// handleImport validates the complete snapshot before publishing it and streams ImportProgress lines.
+// The body is spooled to a temporary file while it is validated, so large snapshots are not held in memory.
+// Imports restore exported snapshots and are exempt from approvals, like the manifest file.
+func handleImport(res http.ResponseWriter, r *http.Request) {
+	token, err := getTenantAdminToken(r)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	t, err := getTenant(token)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	format, err := commandfile.FormatOf(r.Header.Get("Content-Type"))
+	if err != nil || format == commandfile.Yaml {
+		problem.Write(res, r, http.StatusUnsupportedMediaType, problem.ValidationFailed, "expected application/x-ndjson or text/csv")
+		return
+	}
+	spool, err := os.CreateTemp("", "permission-import-*")
+	if err != nil {
+		problem.WriteInternal(res, r, http.StatusInternalServerError, problem.Internal, err)
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	total, err := validateImport(token, io.TeeReader(r.Body, spool), format)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	res.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(res)
+	flusher, _ := res.(http.Flusher)
+	report := func(progress ImportProgress) {
+		encoder.Encode(progress)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	report(ImportProgress{Status: "validated", Total: total})
+	if dryRun {
+		return
+	}
+	fail := func(published int, p problem.Problem) {
+		p = problem.LogCause(r, p)
+		report(ImportProgress{Status: "failed", Published: published, Total: total, Error: &p})
+	}
+	_, err = spool.Seek(0, io.SeekStart)
+	if err != nil {
+		fail(0, problem.Wrap(http.StatusInternalServerError, problem.Internal, err))
+		return
+	}
+	commands, err := commandfile.NewReader(spool, format)
+	if err != nil {
+		fail(0, problem.Wrap(http.StatusInternalServerError, problem.Internal, err))
+		return
+	}
+	for published := 0; ; published++ {
+		command, err := commands.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fail(published, problem.Wrap(http.StatusInternalServerError, problem.Internal, err))
+			return
+		}
+		err = sendTenantEvent(t, CommandFromModel(command))
+		if err != nil {
+			fail(published, problem.Wrap(http.StatusInternalServerError, problem.PublishFailed, err))
+			return
+		}
+		if (published+1)%importProgressInterval == 0 && published+1 < total {
+			report(ImportProgress{Status: "publishing", Published: published + 1, Total: total})
+		}
+	}
+	report(ImportProgress{Status: "done", Published: total, Total: total})
+}
+
+// validateImport reads every command of the snapshot and returns their number or the problem of the first invalid one
+func validateImport(token auth.Token, reader io.Reader, format commandfile.Format) (total int, err error) {
+	commands, err := commandfile.NewReader(reader, format)
+	if err != nil {
+		return 0, problem.New(http.StatusBadRequest, problem.ValidationFailed, err.Error())
+	}
+	for {
+		command, err := commands.Read()
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, problem.New(http.StatusBadRequest, problem.ValidationFailed, err.Error())
+		}
+		err = ValidateModelCommand(command)
+		if err == nil {
+			err = CheckCommand(token, CommandFromModel(command))
+		}
+		if err != nil {
+			return total, withIndex(err, total)
+		}
+		total++
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// failingTransport counts the requests sent to kafka and fails all of them
+type failingTransport struct {
+	calls atomic.Int32
+}
+
+func (this *failingTransport) RoundTrip(ctx context.Context, addr net.Addr, req kafka.Request) (kafka.Response, error) {
+	this.calls.Add(1)
+	return nil, errors.New("kafka unavailable")
+}
+
+func setupImport(t *testing.T) *failingTransport {
+	err := LoadConfig("../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setupPublisher(t)
+}
+
+// setupPublisher replaces the publisher by one whose writes to the topics of the loaded configuration are counted and fail
+func setupPublisher(t *testing.T) *failingTransport {
+	transport := &failingTransport{}
+	publisher := &Publisher{writers: map[string]*kafka.Writer{}}
+	for _, topic := range allPermTopics() {
+		publisher.writers[topic] = &kafka.Writer{Addr: kafka.TCP("kafka:9092"), Topic: topic, MaxAttempts: 1, Transport: transport}
+	}
+	previous := conn
+	conn = publisher
+	t.Cleanup(func() {
+		conn = previous
+	})
+	return transport
+}
+
+func importSnapshot(t *testing.T, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Authorization", testToken(t, "admin", "admin").Token)
+	res := httptest.NewRecorder()
+	handleImport(res, req)
+	return res
+}
+
+func TestImportPublishesNothingIfAnyCommandIsInvalid(t *testing.T) {
+	transport := setupImport(t)
+	body := `{"command": "PUT", "kind": "devices", "resource": "d1", "group": "g1", "right": "rwxa"}` + "\n" +
+		`{"command": "PUT", "kind": "devices", "resource": "d2", "right": "rwxa"}` + "\n"
+	res := importSnapshot(t, body)
+	if res.Code != http.StatusBadRequest || !strings.Contains(res.Body.String(), "command 1") {
+		t.Fatal("expected invalid second command, got", res.Code, res.Body.String())
+	}
+	if transport.calls.Load() != 0 {
+		t.Error("expected nothing to be published")
+	}
+}
+
+func TestImportPublishesAfterValidation(t *testing.T) {
+	transport := setupImport(t)
+	body := `{"command": "PUT", "kind": "devices", "resource": "d1", "group": "g1", "right": "rwxa"}` + "\n" +
+		`{"command": "PUT", "kind": "devices", "resource": "d2", "group": "g1", "right": "rx"}` + "\n"
+	res := importSnapshot(t, body)
+	lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+	if res.Code != http.StatusOK || len(lines) != 2 {
+		t.Fatal("expected validated and failed progress, got", res.Code, res.Body.String())
+	}
+	validated, failed := ImportProgress{}, ImportProgress{}
+	json.Unmarshal([]byte(lines[0]), &validated)
+	json.Unmarshal([]byte(lines[1]), &failed)
+	if validated.Status != "validated" || validated.Total != 2 {
+		t.Errorf("unexpected progress %+v", validated)
+	}
+	if failed.Status != "failed" || failed.Published != 0 || failed.Error == nil {
+		t.Errorf("expected the unavailable kafka to fail the import, got %+v", failed)
+	}
+	if transport.calls.Load() == 0 {
+		t.Error("expected the spooled snapshot to be published")
+	}
+}
@@ -17,184 +17,645 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/SENERGY-Platform/permission-command/lib/approval"
 	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/idempotency"
+	"github.com/SENERGY-Platform/permission-command/lib/jobs"
+	"github.com/SENERGY-Platform/permission-command/lib/manifest"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/openapi"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
 	"github.com/SENERGY-Platform/permission-command/lib/util"
 	"github.com/julienschmidt/httprouter"
+	"io"
 	"log"
 	"net/http"
-
-	"strings"
 )
 
 func StartApi() {
 	log.Println("connect to kafka: ", Config.KafkaUrl)
 	InitEventConn()
 	defer StopEventConn()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	InitProjection()
+	InitOpa()
+	InitApprovals(ctx)
+	InitJobs(ctx)
+	StartManifestWatcher(ctx)
+	StartReconciliationJob(ctx)
+	idempotencyHandler := getIdempotencyHandler()
+	idempotencyHandler.Start(ctx)
 	log.Println("start server on port: ", Config.ServerPort)
-	httpHandler := getRoutes()
+	httpHandler := tenantFilter(getRoutes(idempotencyHandler))
 	corseHandler := util.NewCors(httpHandler)
 	logger := util.NewLogger(corseHandler, Config.LogLevel)
-	log.Println(http.ListenAndServe(":"+Config.ServerPort, logger))
+	requestId := util.NewRequestId(logger)
+	log.Println(http.ListenAndServe(":"+Config.ServerPort, requestId))
 }
 
-func getRoutes() (router *httprouter.Router) {
-	router = httprouter.New()
+func getRoutes(idempotencyHandler *idempotency.Handler) (router *DocumentedRouter) {
+	router = NewDocumentedRouter()
+	router.LimitBodySize(Config.MaxBodySize)
+	router.UseIdempotency(idempotencyHandler)
 
-	router.PUT("/user/:user/:resource_kind/:resource_id/:right", func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		user := ps.ByName("user")
-		kind := ps.ByName("resource_kind")
-		right := ps.ByName("right")
-		resource := ps.ByName("resource_id")
-		token, err := auth.GetParsedToken(r)
+	router.PUT("/user/:user/:resource_kind/:resource_id/:right", &openapi.Operation{
+		OperationId: "setUserRight",
+		Summary:     "set the rights of a user for a resource",
+		Tags:        []string{"user"},
+		Parameters:  []openapi.Parameter{userParam, kindParam, resourceParam, rightParam, ifMatchParam},
+		Responses:   commandResponses(),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleCommand(res, r, PermCommandMsg{
+			Command:  model.CommandPut,
+			Kind:     ps.ByName("resource_kind"),
+			Resource: ps.ByName("resource_id"),
+			User:     ps.ByName("user"),
+			Right:    ps.ByName("right"),
+		})
+	})
+
+	router.PUT("/user/:user/:resource_kind/:resource_id", &openapi.Operation{
+		OperationId: "setUserRightEmpty",
+		Summary:     "set an empty right for a user, which removes all of the users rights on the resource",
+		Tags:        []string{"user"},
+		Parameters:  []openapi.Parameter{userParam, kindParam, resourceParam, ifMatchParam},
+		Responses:   commandResponses(),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleCommand(res, r, PermCommandMsg{
+			Command:  model.CommandPut,
+			Kind:     ps.ByName("resource_kind"),
+			Resource: ps.ByName("resource_id"),
+			User:     ps.ByName("user"),
+		})
+	})
+
+	router.DELETE("/user/:user/:resource_kind/:resource_id", &openapi.Operation{
+		OperationId: "deleteUserRight",
+		Summary:     "remove the user from the resource",
+		Tags:        []string{"user"},
+		Parameters:  []openapi.Parameter{userParam, kindParam, resourceParam, ifMatchParam},
+		Responses:   commandResponses(),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleCommand(res, r, PermCommandMsg{
+			Command:  model.CommandDelete,
+			Kind:     ps.ByName("resource_kind"),
+			Resource: ps.ByName("resource_id"),
+			User:     ps.ByName("user"),
+		})
+	})
+
+	router.DELETE("/user/:user", &openapi.Operation{
+		OperationId: "removeUserEverywhere",
+		Summary:     "remove the user from every resource (offboarding)",
+		Description: "requires the admin realm role; discovers all rights of the user from the permission topic " +
+			"and publishes a DELETE command for each resource in a background job",
+		Tags:       []string{"user", "admin"},
+		Parameters: []openapi.Parameter{userParam},
+		Responses:  jobAccepted(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token, err := getTenantAdminToken(r)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.WriteError(res, r, err)
 			return
 		}
-		handleUserRightPut(res, user, kind, resource, right, token)
-	})
-
-	router.PUT("/user/:user/:resource_kind/:resource_id", func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		user := ps.ByName("user")
-		kind := ps.ByName("resource_kind")
-		right := ""
-		resource := ps.ByName("resource_id")
-		token, err := auth.GetParsedToken(r)
+		job, err := RemoveUserEverywhere(token, ps.ByName("user"))
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.WriteError(res, r, err)
 			return
 		}
-		handleUserRightPut(res, user, kind, resource, right, token)
+		sendJob(res, job)
 	})
 
-	router.DELETE("/user/:user/:resource_kind/:resource_id", func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		user := ps.ByName("user")
-		kind := ps.ByName("resource_kind")
-		resource := ps.ByName("resource_id")
-		token, err := auth.GetParsedToken(r)
+	router.PUT("/group/:group/:resource_kind/:resource_id/:right", &openapi.Operation{
+		OperationId: "setGroupRight",
+		Summary:     "set the rights of a group for a resource",
+		Tags:        []string{"group"},
+		Parameters:  []openapi.Parameter{groupParam, kindParam, resourceParam, rightParam, ifMatchParam},
+		Responses:   commandResponses(),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleCommand(res, r, PermCommandMsg{
+			Command:  model.CommandPut,
+			Kind:     ps.ByName("resource_kind"),
+			Resource: ps.ByName("resource_id"),
+			Group:    ps.ByName("group"),
+			Right:    ps.ByName("right"),
+		})
+	})
+
+	router.PUT("/group/:group/:resource_kind/:resource_id", &openapi.Operation{
+		OperationId: "setGroupRightEmpty",
+		Summary:     "set an empty right for a group, which removes all of the groups rights on the resource",
+		Tags:        []string{"group"},
+		Parameters:  []openapi.Parameter{groupParam, kindParam, resourceParam, ifMatchParam},
+		Responses:   commandResponses(),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleCommand(res, r, PermCommandMsg{
+			Command:  model.CommandPut,
+			Kind:     ps.ByName("resource_kind"),
+			Resource: ps.ByName("resource_id"),
+			Group:    ps.ByName("group"),
+		})
+	})
+
+	router.DELETE("/group/:group/:resource_kind/:resource_id", &openapi.Operation{
+		OperationId: "deleteGroupRight",
+		Summary:     "remove the group from the resource",
+		Tags:        []string{"group"},
+		Parameters:  []openapi.Parameter{groupParam, kindParam, resourceParam, ifMatchParam},
+		Responses:   commandResponses(),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleCommand(res, r, PermCommandMsg{
+			Command:  model.CommandDelete,
+			Kind:     ps.ByName("resource_kind"),
+			Resource: ps.ByName("resource_id"),
+			Group:    ps.ByName("group"),
+		})
+	})
+
+	router.DELETE("/group/:group", &openapi.Operation{
+		OperationId: "removeGroupEverywhere",
+		Summary:     "remove the group from every resource",
+		Description: "requires the admin realm role; the admin group can not be removed. " +
+			"Publishes a DELETE command for every resource of the group in a background job",
+		Tags:       []string{"group", "admin"},
+		Parameters: []openapi.Parameter{groupParam},
+		Responses:  jobAccepted(http.StatusUnauthorized, http.StatusForbidden),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token, err := getTenantAdminToken(r)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.WriteError(res, r, err)
 			return
 		}
-		if token.GetUserId() == user {
-			log.Println("WARNING: user cant remove his own rights")
-			http.Error(res, "user cant remove his own rights", http.StatusBadRequest)
+		job, err := RemoveGroupEverywhere(token, ps.ByName("group"))
+		if err != nil {
+			problem.WriteError(res, r, err)
 			return
 		}
-		err = HasAdminRight(token.Token, kind, resource)
+		sendJob(res, job)
+	})
+
+	router.POST("/group/:group/migration", &openapi.Operation{
+		OperationId: "migrateGroup",
+		Summary:     "move every right of the group to another group",
+		Description: "requires the admin realm role; the admin group can not be migrated. " +
+			"The target group receives the rights of the group (merged with its own rights), then the group is removed, in a background job",
+		Tags:       []string{"group", "admin"},
+		Parameters: []openapi.Parameter{groupParam},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  openapi.JsonContent(openapi.Ref("GroupMigration")),
+		},
+		Responses: jobAccepted(http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token, err := getTenantAdminToken(r)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusUnauthorized)
+			problem.WriteError(res, r, err)
 			return
 		}
-		err = DeleteUserRight(kind, resource, user)
+		migration := GroupMigration{}
+		err = json.NewDecoder(r.Body).Decode(&migration)
 		if err != nil {
-			log.Println("ERROR", err)
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			problem.Write(res, r, http.StatusBadRequest, problem.ValidationFailed, "invalid json")
 			return
 		}
-		ok := map[string]string{"status": "ok"}
-		json.NewEncoder(res).Encode(ok)
-	})
-
-	router.PUT("/group/:group/:resource_kind/:resource_id/:right", func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		group := ps.ByName("group")
-		kind := ps.ByName("resource_kind")
-		right := ps.ByName("right")
-		resource := ps.ByName("resource_id")
-		token, err := auth.GetParsedToken(r)
+		job, err := MigrateGroup(token, ps.ByName("group"), migration.Target)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.WriteError(res, r, err)
 			return
 		}
-		handleGroupRightPut(res, group, kind, resource, right, token)
+		sendJob(res, job)
 	})
 
-	router.PUT("/group/:group/:resource_kind/:resource_id", func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		group := ps.ByName("group")
-		kind := ps.ByName("resource_kind")
-		right := ""
-		resource := ps.ByName("resource_id")
+	router.POST("/batch", &openapi.Operation{
+		OperationId: "batch",
+		Summary:     "apply multiple permission commands",
+		Description: "all commands are checked before the first one is published; commands are published in the given order. " +
+			"With If-Match, all commands have to target the same resource.",
+		Tags:       []string{"batch"},
+		Parameters: []openapi.Parameter{ifMatchParam},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  openapi.JsonContent(&openapi.Schema{Type: "array", MinItems: 1, MaxItems: MaxBatchSize, Items: openapi.Ref("Command")}),
+		},
+		Responses: commandResponses(),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		token, err := auth.GetParsedToken(r)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.Write(res, r, http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
 			return
 		}
-		handleGroupRightPut(res, group, kind, resource, right, token)
+		t, err := getTenant(token)
+		if err != nil {
+			problem.WriteError(res, r, err)
+			return
+		}
+		commands := []model.Command{}
+		err = json.NewDecoder(r.Body).Decode(&commands)
+		if err != nil {
+			problem.Write(res, r, http.StatusBadRequest, problem.ValidationFailed, "invalid json")
+			return
+		}
+		msgs := []PermCommandMsg{}
+		for i, command := range commands {
+			if command.Command == model.CommandPut {
+				command.Right, err = GetRoles().Expand(command.Kind, command.Right)
+				if err != nil {
+					problem.WriteError(res, r, withIndex(problem.New(http.StatusBadRequest, problem.ValidationFailed, err.Error()), i))
+					return
+				}
+			}
+			err = ValidateModelCommand(command)
+			if err == nil {
+				msg := CommandFromModel(command)
+				err = checkAndAuthorize(token, msg)
+				msgs = append(msgs, msg)
+			}
+			if err != nil {
+				problem.WriteError(res, r, withIndex(err, i))
+				return
+			}
+		}
+		if r.Header.Get("If-Match") != "" {
+			for i, msg := range msgs {
+				if msg.Kind != msgs[0].Kind || msg.Resource != msgs[0].Resource {
+					problem.WriteError(res, r, withIndex(problem.New(http.StatusBadRequest, problem.ValidationFailed, "If-Match requires all commands to target the same resource"), i))
+					return
+				}
+			}
+		}
+		if parkIfRequired(res, r, token, msgs) {
+			return
+		}
+		done := func(bool) {}
+		if r.Header.Get("If-Match") != "" {
+			done, err = checkIfMatch(r, token, msgs[0].Kind, msgs[0].Resource)
+			if err != nil {
+				problem.WriteError(res, r, err)
+				return
+			}
+		}
+		for i, msg := range msgs {
+			err = sendTenantEvent(t, msg)
+			done(err == nil || i > 0)
+			if err != nil {
+				p := problem.Wrap(http.StatusInternalServerError, problem.PublishFailed, err)
+				p.Detail = fmt.Sprintf("published %v of %v commands", i, len(msgs))
+				problem.WriteError(res, r, p)
+				return
+			}
+		}
+		sendOk(res)
 	})
 
-	router.DELETE("/group/:group/:resource_kind/:resource_id", func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		group := ps.ByName("group")
-		kind := ps.ByName("resource_kind")
-		resource := ps.ByName("resource_id")
-
+	router.POST("/apply", &openapi.Operation{
+		OperationId: "applyManifest",
+		Summary:     "publish the commands needed to reach the rights declared in the manifest",
+		Description: "the current rights are read from the local projection of the permission topic; " +
+			"with prune, undeclared rights of the listed resources are removed",
+		Tags: []string{"batch"},
+		Parameters: []openapi.Parameter{{
+			Name:        "dry_run",
+			In:          "query",
+			Description: "only return the commands which would be published",
+			Schema:      &openapi.Schema{Type: "boolean"},
+		}},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content: map[string]*openapi.MediaType{
+				"application/json": {Schema: openapi.Ref("Manifest")},
+				"application/yaml": {Schema: openapi.Ref("Manifest")},
+			},
+		},
+		Responses: withApproval(responses(&openapi.Response{Description: "published commands", Content: openapi.JsonContent(openapi.Ref("ApplyResult"))},
+			append(commandProblems, http.StatusServiceUnavailable)...)),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		token, err := auth.GetParsedToken(r)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusBadRequest)
+			problem.Write(res, r, http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
 			return
 		}
-
-		// users may not remove admin from resource
-		if group == "admin" && !token.IsAdmin() {
-			http.Error(res, "only admin group may remove admin group from resource", http.StatusForbidden)
+		if Config.MaxBodySize > 0 {
+			r.Body = http.MaxBytesReader(res, r.Body, Config.MaxBodySize)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.WriteBodyError(res, r, err)
+			return
+		}
+		m, err := manifest.Parse(body, manifest.IsYaml(r.Header.Get("Content-Type")), GetRoles().Expand)
+		if err != nil {
+			problem.Write(res, r, http.StatusBadRequest, problem.ValidationFailed, err.Error())
+			return
+		}
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+		if approvals != nil && !dryRun {
+			planned, err := ApplyManifest(m, &token, true)
+			if err != nil {
+				problem.WriteError(res, r, err)
+				return
+			}
+			msgs := []PermCommandMsg{}
+			for _, command := range planned.Commands {
+				msgs = append(msgs, CommandFromModel(command))
+			}
+			if parkIfRequired(res, r, token, msgs) {
+				return
+			}
+		}
+		result, err := ApplyManifest(m, &token, dryRun)
+		if err != nil {
+			problem.WriteError(res, r, err)
 			return
 		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(result)
+	})
 
-		err = HasAdminRight(token.Token, kind, resource)
+	router.GET("/admin/export", &openapi.Operation{
+		OperationId: "exportPermissions",
+		Summary:     "stream every current right of the permission topic as PUT commands",
+		Description: "requires the admin realm role; reads the local projection or, if disabled, replays the permission topic",
+		Tags:        []string{"admin"},
+		Parameters: []openapi.Parameter{{
+			Name:   "format",
+			In:     "query",
+			Schema: &openapi.Schema{Type: "string", Enum: []string{"jsonl", "csv"}},
+		}},
+		Responses: responses(&openapi.Response{
+			Description: "one command per line",
+			Content: map[string]*openapi.MediaType{
+				"application/x-ndjson": {Schema: openapi.Ref("Command")},
+				"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+			},
+		}, http.StatusUnauthorized, http.StatusForbidden, http.StatusBadGateway, http.StatusServiceUnavailable),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleExport(res, r)
+	})
+
+	router.POST("/admin/import", &openapi.Operation{
+		OperationId: "importPermissions",
+		Summary:     "validate a snapshot and republish it as permission commands",
+		Description: "requires the admin realm role; all commands are validated before the first one is published. " +
+			"The response streams ImportProgress json lines.",
+		Tags: []string{"admin"},
+		Parameters: []openapi.Parameter{{
+			Name:        "dry_run",
+			In:          "query",
+			Description: "only validate the snapshot",
+			Schema:      &openapi.Schema{Type: "boolean"},
+		}},
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Streamed: true,
+			Content: map[string]*openapi.MediaType{
+				"application/x-ndjson": {Schema: openapi.Ref("Command")},
+				"text/csv":             {Schema: &openapi.Schema{Type: "string"}},
+			},
+		},
+		Responses: responses(&openapi.Response{
+			Description: "progress as json lines",
+			Content:     map[string]*openapi.MediaType{"application/x-ndjson": {Schema: openapi.Ref("ImportProgress")}},
+		}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusUnsupportedMediaType),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleImport(res, r)
+	})
+
+	router.GET("/admin/reconciliation", &openapi.Operation{
+		OperationId: "getReconciliationReport",
+		Summary:     "report of the last reconciliation between the permission topic and permission-search",
+		Description: "requires the admin realm role",
+		Tags:        []string{"admin"},
+		Responses: responses(&openapi.Response{Description: "last report", Content: openapi.JsonContent(openapi.Ref("ReconciliationReport"))},
+			http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		token, err := getTenantAdminToken(r)
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusUnauthorized)
+			problem.WriteError(res, r, err)
 			return
 		}
-		err = DeleteGroupRight(kind, resource, group)
+		t, err := getTenant(token)
 		if err != nil {
-			log.Println("ERROR", err)
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			problem.WriteError(res, r, err)
+			return
+		}
+		report := GetLastReconciliation(t)
+		if report == nil {
+			problem.Write(res, r, http.StatusNotFound, problem.NotFound, "no reconciliation has finished yet")
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(report)
+	})
+
+	router.GET("/jobs/:id", &openapi.Operation{
+		OperationId: "getJob",
+		Summary:     "progress and report of a background job",
+		Description: "jobs are visible to the user who started them and to tokens with the admin realm role",
+		Tags:        []string{"jobs"},
+		Parameters:  []openapi.Parameter{jobIdParam},
+		Responses: responses(&openapi.Response{Description: "job", Content: openapi.JsonContent(openapi.Ref("Job"))},
+			http.StatusUnauthorized, http.StatusNotFound),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleGetJob(res, r, ps.ByName("id"))
+	})
+
+	router.GET("/jobs", &openapi.Operation{
+		OperationId: "listJobs",
+		Summary:     "list jobs without items, newest first",
+		Description: "users see their own jobs, tokens with the admin realm role see all jobs",
+		Tags:        []string{"jobs"},
+		Responses: responses(&openapi.Response{Description: "jobs", Content: openapi.JsonContent(&openapi.Schema{Type: "array", Items: openapi.Ref("Job")})},
+			http.StatusUnauthorized),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleListJobs(res, r)
+	})
+
+	router.POST("/jobs/:id/cancel", &openapi.Operation{
+		OperationId: "cancelJob",
+		Summary:     "cancel a pending or running job after the command currently published",
+		Tags:        []string{"jobs"},
+		Parameters:  []openapi.Parameter{jobIdParam},
+		Responses: responses(&openapi.Response{Description: "canceled job", Content: openapi.JsonContent(openapi.Ref("Job"))},
+			http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleJobAction(res, r, ps.ByName("id"), (*jobs.Manager).Cancel, false)
+	})
+
+	router.POST("/jobs/:id/retry", &openapi.Operation{
+		OperationId: "retryJob",
+		Summary:     "requeue a finished job to process its failed and unprocessed commands again",
+		Tags:        []string{"jobs"},
+		Parameters:  []openapi.Parameter{jobIdParam},
+		Responses:   jobAccepted(http.StatusUnauthorized, http.StatusNotFound, http.StatusConflict),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleJobAction(res, r, ps.ByName("id"), (*jobs.Manager).Retry, true)
+	})
+
+	router.GET("/resources/:resource_kind/:resource_id", &openapi.Operation{
+		OperationId: "getResourceRights",
+		Summary:     "current rights of a resource from the local projection",
+		Description: "requires the administration right; the version is also returned as ETag header, " +
+			"to be sent as If-Match with changes of the resource. If-None-Match is answered with 304 if the version is unchanged",
+		Tags:       []string{"resource"},
+		Parameters: []openapi.Parameter{kindParam, resourceParam},
+		Responses: responses(&openapi.Response{Description: "rights of the resource", Content: openapi.JsonContent(openapi.Ref("ResourceRights"))},
+			http.StatusUnauthorized, http.StatusForbidden, http.StatusBadGateway, http.StatusServiceUnavailable),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleGetResource(res, r, ps.ByName("resource_kind"), ps.ByName("resource_id"))
+	})
+
+	router.GET("/approvals", &openapi.Operation{
+		OperationId: "listApprovals",
+		Summary:     "list changes waiting for or decided by a second administrator, newest first",
+		Description: "users see their own changes, tokens with the admin realm role see all changes",
+		Tags:        []string{"approvals"},
+		Parameters: []openapi.Parameter{{
+			Name:   "status",
+			In:     "query",
+			Schema: &openapi.Schema{Type: "string", Enum: []string{approval.StatusPending, approval.StatusApproved, approval.StatusRejected, approval.StatusExpired, approval.StatusFailed}},
+		}},
+		Responses: responses(&openapi.Response{Description: "changes", Content: openapi.JsonContent(&openapi.Schema{Type: "array", Items: openapi.Ref("Change")})},
+			http.StatusUnauthorized, http.StatusNotFound),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleListApprovals(res, r)
+	})
+
+	router.GET("/approvals/:id", &openapi.Operation{
+		OperationId: "getApproval",
+		Summary:     "get a change waiting for approval",
+		Tags:        []string{"approvals"},
+		Parameters:  []openapi.Parameter{approvalIdParam},
+		Responses: responses(&openapi.Response{Description: "change", Content: openapi.JsonContent(openapi.Ref("Change"))},
+			http.StatusUnauthorized, http.StatusNotFound),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleGetApproval(res, r, ps.ByName("id"))
+	})
+
+	router.POST("/approvals/:id/approve", &openapi.Operation{
+		OperationId: "approveChange",
+		Summary:     "approve a pending change and publish its commands",
+		Description: "requires the admin realm role; the requester of a change can not approve it",
+		Tags:        []string{"approvals"},
+		Parameters:  []openapi.Parameter{approvalIdParam},
+		RequestBody: &openapi.RequestBody{Content: openapi.JsonContent(openapi.Ref("ApprovalDecision"))},
+		Responses: responses(&openapi.Response{Description: "approved change", Content: openapi.JsonContent(openapi.Ref("Change"))},
+			http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleDecision(res, r, ps.ByName("id"), true)
+	})
+
+	router.POST("/approvals/:id/reject", &openapi.Operation{
+		OperationId: "rejectChange",
+		Summary:     "reject a pending change",
+		Description: "requires the admin realm role; the requester of a change can not reject it",
+		Tags:        []string{"approvals"},
+		Parameters:  []openapi.Parameter{approvalIdParam},
+		RequestBody: &openapi.RequestBody{Content: openapi.JsonContent(openapi.Ref("ApprovalDecision"))},
+		Responses: responses(&openapi.Response{Description: "rejected change", Content: openapi.JsonContent(openapi.Ref("Change"))},
+			http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleDecision(res, r, ps.ByName("id"), false)
+	})
+
+	router.GET("/roles", &openapi.Operation{
+		OperationId: "listRoles",
+		Summary:     "named roles accepted in place of right strings, by resource kind",
+		Description: "the kind * lists the roles of every kind; with the kind parameter, the roles of that kind including those of * are returned",
+		Tags:        []string{"meta"},
+		Parameters: []openapi.Parameter{{
+			Name:   "kind",
+			In:     "query",
+			Schema: &openapi.Schema{Type: "string"},
+		}},
+		Responses: responses(&openapi.Response{Description: "kind -> roles", Content: openapi.JsonContent(&openapi.Schema{
+			Type:                 "object",
+			AdditionalProperties: &openapi.Schema{Type: "array", Items: openapi.Ref("Role")},
+		})}),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		handleListRoles(res, r)
+	})
+
+	router.GET("/projection", &openapi.Operation{
+		OperationId: "getProjectionStatus",
+		Summary:     "sync state and lag of the local projection of the permission topic",
+		Tags:        []string{"meta"},
+		Responses: responses(&openapi.Response{Description: "projection status", Content: openapi.JsonContent(openapi.Ref("ProjectionStatus"))},
+			http.StatusServiceUnavailable),
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if localProjection == nil {
+			problem.Write(res, r, http.StatusServiceUnavailable, problem.ProjectionUnavailable, "the local permission projection is disabled")
 			return
 		}
-		ok := map[string]string{"status": "ok"}
-		json.NewEncoder(res).Encode(ok)
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(localProjection.Status())
 	})
 
 	return
 }
 
-func handleUserRightPut(res http.ResponseWriter, user string, kind string, resource string, right string, token auth.Token) {
-	if token.GetUserId() == user && !strings.Contains(right, "a") {
-		log.Println("WARNING: user cant remove own administration right")
-		http.Error(res, "user cant remove own administration right", http.StatusBadRequest)
+const MaxBatchSize = 1000
+
+func handleCommand(res http.ResponseWriter, r *http.Request, cmd PermCommandMsg) {
+	token, err := auth.GetParsedToken(r)
+	if err != nil {
+		problem.Write(res, r, http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
 		return
 	}
-	err := HasAdminRight(token.Token, kind, resource)
+	t, err := getTenant(token)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusUnauthorized)
+		problem.WriteError(res, r, err)
 		return
 	}
-	err = SetUserRight(kind, resource, user, right)
+	cmd, err = expandRole(cmd)
 	if err != nil {
-		log.Println("ERROR", err)
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		problem.WriteError(res, r, err)
 		return
 	}
-	ok := map[string]string{"status": "ok"}
-	json.NewEncoder(res).Encode(ok)
-}
-
-func handleGroupRightPut(res http.ResponseWriter, group string, kind string, resource string, right string, token auth.Token) {
-	// users may not remove admin from resource
-	if group == "admin" && !token.IsAdmin() && !strings.Contains(right, "a") {
-		http.Error(res, "only admin group may remove admin group from resource", http.StatusForbidden)
+	err = checkAndAuthorize(token, cmd)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	if parkIfRequired(res, r, token, []PermCommandMsg{cmd}) {
 		return
 	}
-	err := HasAdminRight(token.Token, kind, resource)
+	done, err := checkIfMatch(r, token, cmd.Kind, cmd.Resource)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusUnauthorized)
+		problem.WriteError(res, r, err)
 		return
 	}
-	err = SetGroupRight(kind, resource, group, right)
+	err = sendTenantEvent(t, cmd)
+	done(err == nil)
 	if err != nil {
-		log.Println("ERROR", err)
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		problem.WriteInternal(res, r, http.StatusInternalServerError, problem.PublishFailed, err)
 		return
 	}
+	sendCommandOk(res, cmd)
+}
+
+func checkAndAuthorize(token auth.Token, cmd PermCommandMsg) error {
+	err := CheckCommand(token, cmd)
+	if err != nil {
+		return err
+	}
+	return AuthorizeCommand(token, cmd)
+}
+
+// withIndex prefixes the detail of problems with the position of the failing batch element
+func withIndex(err error, index int) error {
+	p, ok := err.(problem.Problem)
+	if !ok {
+		return err
+	}
+	p.Detail = fmt.Sprintf("command %v: %v", index, p.Detail)
+	return p
+}
+
+func sendOk(res http.ResponseWriter) {
 	ok := map[string]string{"status": "ok"}
 	json.NewEncoder(res).Encode(ok)
 }
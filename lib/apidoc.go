@@ -0,0 +1,338 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/SENERGY-Platform/permission-command/lib/idempotency"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/openapi"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/projection"
+	"github.com/SENERGY-Platform/permission-command/lib/roles"
+)
+
+// RightOrRolePattern accepts right strings and role names, see GetRoles
+const RightOrRolePattern = roles.NamePattern
+
+var userParam = openapi.Parameter{
+	Name:        "user",
+	In:          "path",
+	Required:    true,
+	Description: "id of the user (token subject)",
+	Schema:      &openapi.Schema{Type: "string", MinLength: 1},
+}
+
+var groupParam = openapi.Parameter{
+	Name:        "group",
+	In:          "path",
+	Required:    true,
+	Description: "name of the group (keycloak realm role)",
+	Schema:      &openapi.Schema{Type: "string", MinLength: 1},
+}
+
+var kindParam = openapi.Parameter{
+	Name:        "resource_kind",
+	In:          "path",
+	Required:    true,
+	Description: "kind of the resource, e.g. devices",
+	Schema:      &openapi.Schema{Type: "string", MinLength: 1},
+}
+
+var resourceParam = openapi.Parameter{
+	Name:        "resource_id",
+	In:          "path",
+	Required:    true,
+	Description: "id of the resource",
+	Schema:      &openapi.Schema{Type: "string", MinLength: 1},
+}
+
+var rightParam = openapi.Parameter{
+	Name:        "right",
+	In:          "path",
+	Required:    true,
+	Description: "combination of r (read), w (write), x (execute) and a (administrate) or the name of a role, see GET /roles",
+	Schema:      &openapi.Schema{Type: "string", Pattern: RightOrRolePattern},
+}
+
+var jobIdParam = openapi.Parameter{
+	Name:        "id",
+	In:          "path",
+	Required:    true,
+	Description: "id of the job",
+	Schema:      &openapi.Schema{Type: "string", MinLength: 1},
+}
+
+var approvalIdParam = openapi.Parameter{
+	Name:        "id",
+	In:          "path",
+	Required:    true,
+	Description: "id of the change waiting for approval",
+	Schema:      &openapi.Schema{Type: "string", MinLength: 1},
+}
+
+var ifMatchParam = openapi.Parameter{
+	Name:        "If-Match",
+	In:          "header",
+	Description: "ETag of GET /resources/{resource_kind}/{resource_id}; changes of other versions are rejected with 412. Requires the local projection",
+	Schema:      &openapi.Schema{Type: "string", MinLength: 1},
+}
+
+var idempotencyKeyParam = openapi.Parameter{
+	Name:        idempotency.Header,
+	In:          "header",
+	Description: "repeated requests with the same key and body get the original response without publishing again",
+	Schema:      &openapi.Schema{Type: "string", MinLength: 1},
+}
+
+func newApiDocument() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:       "permission-command",
+		Description: "http-api to update permissions for resources by creating kafka messages which will be consumed by permission-search and other services",
+		Version:     "1.0.0",
+	})
+	doc.Security = []map[string][]string{{"bearerAuth": {}}}
+	doc.Components.SecuritySchemes["bearerAuth"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+	doc.Components.Schemas["Problem"] = &openapi.Schema{
+		Type:     "object",
+		Required: []string{"type", "title", "status", "code"},
+		Properties: map[string]*openapi.Schema{
+			"type":       {Type: "string"},
+			"title":      {Type: "string"},
+			"status":     {Type: "integer"},
+			"detail":     {Type: "string"},
+			"instance":   {Type: "string"},
+			"code":       {Type: "string", Description: "stable machine readable error code"},
+			"request_id": {Type: "string"},
+			"rule":       {Type: "string", Description: "id of the violated policy rule"},
+		},
+	}
+	doc.Components.Schemas["Command"] = &openapi.Schema{
+		Type:     "object",
+		Required: []string{"command", "kind", "resource"},
+		Properties: map[string]*openapi.Schema{
+			"command":  {Type: "string", Enum: []string{model.CommandPut, model.CommandDelete}},
+			"kind":     {Type: "string", MinLength: 1},
+			"resource": {Type: "string", MinLength: 1},
+			"user":     {Type: "string", Description: "exactly one of user and group has to be set"},
+			"group":    {Type: "string", Description: "exactly one of user and group has to be set"},
+			"right":    {Type: "string", Pattern: roles.OptionalNamePattern, Description: "right string or role name, ignored for DELETE"},
+		},
+	}
+	rightMap := &openapi.Schema{Type: "object", AdditionalProperties: &openapi.Schema{Type: "string", Pattern: RightOrRolePattern}, Description: "user or group -> right string or role name"}
+	doc.Components.Schemas["Manifest"] = &openapi.Schema{
+		Type:     "object",
+		Required: []string{"resources"},
+		Properties: map[string]*openapi.Schema{
+			"prune": {Type: "boolean", Description: "remove rights of the listed resources which are not declared"},
+			"resources": {Type: "array", MinItems: 1, Items: &openapi.Schema{
+				Type:     "object",
+				Required: []string{"kind", "resource"},
+				Properties: map[string]*openapi.Schema{
+					"kind":     {Type: "string", MinLength: 1},
+					"resource": {Type: "string", MinLength: 1},
+					"users":    rightMap,
+					"groups":   rightMap,
+				},
+			}},
+		},
+	}
+	doc.Components.Schemas["ApplyResult"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"dry_run":  {Type: "boolean"},
+			"commands": {Type: "array", Items: openapi.Ref("Command")},
+		},
+	}
+	doc.Components.Schemas["ProjectionStatus"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"synced": {Type: "boolean", Description: "all messages existing on startup have been applied"},
+			"error":  {Type: "string", Description: "why the projection can not become synced, e.g. a failed partition consumer"},
+			"lag":    {Type: "integer", Description: "sum of the partition lags"},
+			"partitions": {Type: "array", Items: &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"topic":       {Type: "string"},
+					"partition":   {Type: "integer"},
+					"next_offset": {Type: "integer"},
+					"lag":         {Type: "integer"},
+				},
+			}},
+		},
+	}
+	doc.Components.Schemas["ImportProgress"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"status":    {Type: "string", Enum: []string{"validated", "publishing", "done", "failed"}},
+			"published": {Type: "integer"},
+			"total":     {Type: "integer"},
+			"error":     openapi.Ref("Problem"),
+		},
+	}
+	doc.Components.Schemas["ReconciliationReport"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"tenant":     {Type: "string"},
+			"started":    {Type: "string", Format: "date-time"},
+			"finished":   {Type: "string", Format: "date-time"},
+			"resources":  {Type: "integer"},
+			"consistent": {Type: "integer"},
+			"repaired":   {Type: "integer"},
+			"skipped":    {Type: "integer"},
+			"findings": {Type: "array", Items: &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"type":     {Type: "string", Enum: []string{"missing", "divergent", "unexpected", "resource_missing", "error"}},
+					"kind":     {Type: "string"},
+					"resource": {Type: "string"},
+					"user":     {Type: "string"},
+					"group":    {Type: "string"},
+					"expected": {Type: "string"},
+					"actual":   {Type: "string"},
+					"error":    {Type: "string"},
+					"repaired": {Type: "boolean"},
+					"skipped":  {Type: "boolean"},
+				},
+			}},
+		},
+	}
+	doc.Components.Schemas["Job"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"id":        {Type: "string"},
+			"type":      {Type: "string"},
+			"owner":     {Type: "string"},
+			"tenant":    {Type: "string"},
+			"status":    {Type: "string", Enum: []string{"pending", "running", "done", "failed", "canceled", "parked"}},
+			"change":    {Type: "string", Description: "approval change holding the commands of a parked job"},
+			"created":   {Type: "string", Format: "date-time"},
+			"started":   {Type: "string", Format: "date-time"},
+			"finished":  {Type: "string", Format: "date-time"},
+			"total":     {Type: "integer"},
+			"processed": {Type: "integer"},
+			"failed":    {Type: "integer"},
+			"error":     {Type: "string"},
+			"planned":   {Type: "boolean"},
+			"items": {Type: "array", Items: &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"command":      openapi.Ref("Command"),
+					"done":         {Type: "boolean"},
+					"attempts":     {Type: "integer"},
+					"published_at": {Type: "string", Format: "date-time"},
+					"error":        {Type: "string"},
+				},
+			}},
+		},
+	}
+	doc.Components.Schemas["ResourceRights"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"users":       {Type: "object", AdditionalProperties: &openapi.Schema{Type: "string"}, Description: "user id -> right"},
+			"groups":      {Type: "object", AdditionalProperties: &openapi.Schema{Type: "string"}, Description: "group -> right"},
+			"user_roles":  {Type: "object", AdditionalProperties: &openapi.Schema{Type: "string"}, Description: "user id -> role with exactly the users right"},
+			"group_roles": {Type: "object", AdditionalProperties: &openapi.Schema{Type: "string"}, Description: "group -> role with exactly the groups right"},
+			"version":     {Type: "string", Description: "changes with every command applied to the resource, " + projection.UnknownVersion + " if the resource never had rights"},
+		},
+	}
+	doc.Components.Schemas["Change"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"id":              {Type: "string"},
+			"tenant":          {Type: "string"},
+			"requester":       {Type: "string"},
+			"requester_admin": {Type: "boolean", Description: "the requester held the admin role, policy rules are evaluated again for the requester on approval"},
+			"status":          {Type: "string", Enum: []string{"pending", "approving", "approved", "rejected", "expired", "failed"}},
+			"created":         {Type: "string", Format: "date-time"},
+			"expires":         {Type: "string", Format: "date-time"},
+			"commands":        {Type: "array", Items: openapi.Ref("Command")},
+			"reasons":         {Type: "array", Items: &openapi.Schema{Type: "string"}},
+			"if_match":        {Type: "string", Description: "If-Match header of the request, checked again on approval"},
+			"decider":         {Type: "string"},
+			"decided":         {Type: "string", Format: "date-time"},
+			"comment":         {Type: "string"},
+			"published":       {Type: "integer"},
+			"error":           {Type: "string"},
+		},
+	}
+	doc.Components.Schemas["ApprovalDecision"] = &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"comment": {Type: "string"}},
+	}
+	doc.Components.Schemas["GroupMigration"] = &openapi.Schema{
+		Type:       "object",
+		Required:   []string{"target"},
+		Properties: map[string]*openapi.Schema{"target": {Type: "string", MinLength: 1, Description: "group receiving the rights"}},
+	}
+	doc.Components.Schemas["Status"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"status": {Type: "string", Enum: []string{"ok"}},
+			"right":  {Type: "string", Description: "published right of PUT commands"},
+			"role":   {Type: "string", Description: "role with exactly the published right, if any"},
+		},
+	}
+	doc.Components.Schemas["Role"] = &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"name":  {Type: "string"},
+			"right": {Type: "string", Pattern: roles.RightPattern},
+		},
+	}
+	return doc
+}
+
+// responses documents the success response and the problem responses for the given status codes
+func responses(success *openapi.Response, problemStatus ...int) map[string]*openapi.Response {
+	result := map[string]*openapi.Response{"200": success}
+	for _, status := range problemStatus {
+		result[strconv.Itoa(status)] = &openapi.Response{
+			Description: http.StatusText(status),
+			Content:     map[string]*openapi.MediaType{problem.ContentType: {Schema: openapi.Ref("Problem")}},
+		}
+	}
+	return result
+}
+
+// jobAccepted documents routes starting a background job
+func jobAccepted(problemStatus ...int) map[string]*openapi.Response {
+	result := responses(nil, problemStatus...)
+	delete(result, "200")
+	result["202"] = &openapi.Response{Description: "job started, see Location header", Content: openapi.JsonContent(openapi.Ref("Job"))}
+	return result
+}
+
+// commandResponses documents routes publishing commands, which may be parked for approval
+func commandResponses() map[string]*openapi.Response {
+	return withApproval(responses(statusOk, versionedCommandProblems...))
+}
+
+func withApproval(result map[string]*openapi.Response) map[string]*openapi.Response {
+	result["202"] = &openapi.Response{Description: "the change requires approval by a second administrator, see Location header", Content: openapi.JsonContent(openapi.Ref("Change"))}
+	return result
+}
+
+var statusOk = &openapi.Response{Description: "command published", Content: openapi.JsonContent(openapi.Ref("Status"))}
+
+// commandProblems are the problem responses of every route publishing permission commands
+var commandProblems = []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError, http.StatusBadGateway}
+
+// versionedCommandProblems are the problem responses of command routes accepting If-Match
+var versionedCommandProblems = append([]int{http.StatusPreconditionFailed, http.StatusServiceUnavailable}, commandProblems...)
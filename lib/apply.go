@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/manifest"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+type ApplyResult struct {
+	DryRun   bool            `json:"dry_run"`
+	Commands []model.Command `json:"commands"`
+}
+
+// ApplyManifest publishes the commands needed to reach the state declared by m.
+// If token is not nil, every command is checked and authorized for the token before the first one is published.
+func ApplyManifest(m manifest.Manifest, token *auth.Token, dryRun bool) (result ApplyResult, err error) {
+	if token != nil {
+		err = requireDefaultTopics(*token)
+		if err != nil {
+			return result, err
+		}
+	}
+	p, err := getSyncedProjection()
+	if err != nil {
+		return result, err
+	}
+	result.DryRun = dryRun
+	result.Commands = m.Diff(func(kind string, resource string) (map[string]string, map[string]string) {
+		current, _ := p.Get(kind, resource)
+		return current.Users, current.Groups
+	})
+	if result.Commands == nil {
+		result.Commands = []model.Command{}
+	}
+	if token != nil {
+		for i, command := range result.Commands {
+			err = checkAndAuthorize(*token, CommandFromModel(command))
+			if err != nil {
+				return result, withIndex(err, i)
+			}
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+	for i, command := range result.Commands {
+		err = sendEvent(CommandFromModel(command))
+		if err != nil {
+			p := problem.Wrap(http.StatusInternalServerError, problem.PublishFailed, err)
+			p.Detail = fmt.Sprintf("published %v of %v commands", i, len(result.Commands))
+			return result, p
+		}
+	}
+	return result, nil
+}
+
+// StartManifestWatcher applies Config.ManifestFile whenever its content changes and the projection is synced.
+// Commands of the file are not checked against a user token and do not require approval;
+// the file is trusted like the service configuration.
+func StartManifestWatcher(ctx context.Context) {
+	if Config.ManifestFile == "" {
+		return
+	}
+	interval, err := time.ParseDuration(Config.ManifestCheckInterval)
+	if err != nil {
+		log.Fatal("ERROR: invalid ManifestCheckInterval ", err)
+	}
+	go func() {
+		err := localProjection.WaitForSync(ctx)
+		if err != nil {
+			return
+		}
+		var applied []byte
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			content, err := os.ReadFile(Config.ManifestFile)
+			if err != nil {
+				log.Println("ERROR: unable to read manifest", Config.ManifestFile, err)
+			} else if !bytes.Equal(content, applied) {
+				err = applyManifestFile(content)
+				if err != nil {
+					log.Println("ERROR: unable to apply manifest", Config.ManifestFile, err)
+				} else {
+					applied = content
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func applyManifestFile(content []byte) error {
+	m, err := manifest.Parse(content, manifest.IsYaml(Config.ManifestFile), GetRoles().Expand)
+	if err != nil {
+		return err
+	}
+	result, err := ApplyManifest(m, nil, false)
+	if err != nil {
+		return err
+	}
+	log.Println("applied manifest", Config.ManifestFile, "with", len(result.Commands), "commands")
+	return nil
+}
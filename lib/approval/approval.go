@@ -0,0 +1,245 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package approval parks permission changes until a second administrator approves or rejects them (four-eyes principle)
+package approval
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusApproving = "approving" //approved, the commands are being published
+	StatusApproved  = "approved"  //and published
+	StatusRejected  = "rejected"
+	StatusExpired   = "expired"
+	StatusFailed    = "failed" //approved, but publishing failed
+)
+
+var ErrNotFound = errors.New("change not found")
+var ErrNotPending = errors.New("change is not pending")
+var ErrOwnChange = errors.New("changes can not be decided by their requester")
+
+type Change struct {
+	Id             string          `json:"id"`
+	Tenant         string          `json:"tenant,omitempty"` //the commands are published to the topics of this tenant
+	Requester      string          `json:"requester"`
+	RequesterAdmin bool            `json:"requester_admin,omitempty"` //the requester held the admin role, for policy rules evaluated again on approval
+	Status         string          `json:"status"`
+	Created        time.Time       `json:"created"`
+	Expires        time.Time       `json:"expires"`
+	Commands       []model.Command `json:"commands"`
+	Reasons        []string        `json:"reasons"`            //why the change requires approval
+	IfMatch        string          `json:"if_match,omitempty"` //If-Match header of the request, checked again on approval
+	Decider        string          `json:"decider,omitempty"`
+	Decided        *time.Time      `json:"decided,omitempty"`
+	Comment        string          `json:"comment,omitempty"`
+	Published      int             `json:"published"` //commands published after approval
+	Error          string          `json:"error,omitempty"`
+}
+
+// Publish publishes the commands of an approved change in order and returns how many were published
+type Publish func(change Change) (published int, err error)
+
+type Manager struct {
+	mux     sync.Mutex
+	store   Store
+	ttl     time.Duration
+	changes map[string]*Change
+}
+
+// NewManager loads the changes of store; pending changes expire ttl after their creation
+func NewManager(store Store, ttl time.Duration) (*Manager, error) {
+	changes, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	result := &Manager{store: store, ttl: ttl, changes: map[string]*Change{}}
+	for _, change := range changes {
+		change := change
+		if change.Status == StatusApproving {
+			change.Status = StatusFailed
+			change.Error = "interrupted by restart while publishing, check the published commands before deciding again"
+			result.save(&change)
+		}
+		result.changes[change.Id] = &change
+	}
+	return result, nil
+}
+
+// Submit parks the commands as pending change
+func (this *Manager) Submit(tenant string, requester string, requesterAdmin bool, commands []model.Command, reasons []string, ifMatch string) (Change, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return Change{}, err
+	}
+	now := time.Now()
+	change := &Change{
+		Id:             hex.EncodeToString(id),
+		Tenant:         tenant,
+		Requester:      requester,
+		RequesterAdmin: requesterAdmin,
+		Status:         StatusPending,
+		Created:        now,
+		Expires:        now.Add(this.ttl),
+		Commands:       commands,
+		Reasons:        reasons,
+		IfMatch:        ifMatch,
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	err = this.store.Save(*change)
+	if err != nil {
+		return Change{}, err
+	}
+	this.changes[change.Id] = change
+	return *change, nil
+}
+
+func (this *Manager) Get(id string) (Change, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	change, ok := this.changes[id]
+	if !ok {
+		return Change{}, ErrNotFound
+	}
+	this.expire(change, time.Now())
+	return *change, nil
+}
+
+// List returns the changes with the status (all if empty), newest first
+func (this *Manager) List(status string) (result []Change) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	now := time.Now()
+	result = []Change{}
+	for _, change := range this.changes {
+		this.expire(change, now)
+		if status == "" || change.Status == status {
+			result = append(result, *change)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.After(result[j].Created)
+	})
+	return result
+}
+
+// Approve publishes the commands of a pending change; decider has to differ from the requester.
+// The change is approving while publish runs without the lock, so concurrent decisions fail with ErrNotPending.
+// If publishing fails the change is marked as failed with the number of published commands.
+func (this *Manager) Approve(id string, decider string, comment string, publish Publish) (Change, error) {
+	this.mux.Lock()
+	change, err := this.decide(id, decider)
+	if err != nil {
+		this.mux.Unlock()
+		return Change{}, err
+	}
+	change.Status = StatusApproving
+	change.Comment = comment
+	this.save(change)
+	approving := *change
+	approving.Commands = append([]model.Command{}, change.Commands...)
+	this.mux.Unlock()
+
+	published, err := publish(approving)
+
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	change.Published = published
+	change.Status = StatusApproved
+	if err != nil {
+		change.Status = StatusFailed
+		change.Error = err.Error()
+	}
+	this.save(change)
+	return *change, err
+}
+
+// Reject marks a pending change as rejected without publishing anything
+func (this *Manager) Reject(id string, decider string, comment string) (Change, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	change, err := this.decide(id, decider)
+	if err != nil {
+		return Change{}, err
+	}
+	change.Status = StatusRejected
+	change.Comment = comment
+	this.save(change)
+	return *change, nil
+}
+
+// Cleanup expires pending changes and removes decided changes older than retention
+func (this *Manager) Cleanup(retention time.Duration) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	now := time.Now()
+	for id, change := range this.changes {
+		this.expire(change, now)
+		if change.Status != StatusPending && change.Status != StatusApproving && change.Expires.Add(retention).Before(now) {
+			delete(this.changes, id)
+			err := this.store.Delete(id)
+			if err != nil {
+				this.changes[id] = change
+			}
+		}
+	}
+}
+
+func (this *Manager) decide(id string, decider string) (*Change, error) {
+	change, ok := this.changes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	this.expire(change, now)
+	if change.Status != StatusPending {
+		return nil, ErrNotPending
+	}
+	if change.Requester == decider {
+		return nil, ErrOwnChange
+	}
+	change.Decider = decider
+	change.Decided = &now
+	return change, nil
+}
+
+// expire has to be called with locked mux
+func (this *Manager) expire(change *Change, now time.Time) {
+	if change.Status == StatusPending && now.After(change.Expires) {
+		change.Status = StatusExpired
+		this.save(change)
+	}
+}
+
+func (this *Manager) save(change *Change) {
+	err := this.store.Save(*change)
+	if err != nil {
+		//the change stays in memory, it is lost on restart
+		log.Println("ERROR: unable to save change", change.Id, err)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package approval
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+func TestApprovePublishesWithoutLock(t *testing.T) {
+	manager, err := NewManager(MemoryStore{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := []model.Command{
+		{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u2", Right: "rwxa"},
+		{Command: model.CommandPut, Kind: "devices", Resource: "d2", User: "u2", Right: "rwxa"},
+	}
+	change, err := manager.Submit("", "requester", false, commands, []string{"test"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change, err = manager.Approve(change.Id, "decider", "ok", func(approving Change) (int, error) {
+		//the manager stays usable while publishing
+		current, err := manager.Get(approving.Id)
+		if err != nil || current.Status != StatusApproving {
+			t.Errorf("expected approving change, got %+v %v", current, err)
+		}
+		_, err = manager.Approve(approving.Id, "other", "", func(Change) (int, error) {
+			t.Error("change must not be published twice")
+			return 0, nil
+		})
+		if !errors.Is(err, ErrNotPending) {
+			t.Error("expected ErrNotPending for concurrent approval, got", err)
+		}
+		_, err = manager.Reject(approving.Id, "other", "")
+		if !errors.Is(err, ErrNotPending) {
+			t.Error("expected ErrNotPending for concurrent rejection, got", err)
+		}
+		return len(approving.Commands), nil
+	})
+	if err != nil || change.Status != StatusApproved || change.Published != 2 {
+		t.Fatalf("expected approved change, got %+v %v", change, err)
+	}
+}
+
+func TestApproveRecordsFailure(t *testing.T) {
+	manager, err := NewManager(MemoryStore{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := manager.Submit("", "requester", false, []model.Command{{Command: model.CommandDelete, Kind: "devices", Resource: "d1", Group: "admin"}}, []string{"test"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err = manager.Approve(change.Id, "decider", "", func(Change) (int, error) {
+		return 0, errors.New("kafka unavailable")
+	})
+	if err == nil || change.Status != StatusFailed || change.Error != "kafka unavailable" || change.Published != 0 {
+		t.Fatalf("expected failed change, got %+v %v", change, err)
+	}
+}
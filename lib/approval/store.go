@@ -0,0 +1,66 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package approval
+
+import "github.com/SENERGY-Platform/permission-command/lib/jsonfile"
+
+// Store persists pending and decided changes
+type Store interface {
+	Save(change Change) error
+	Delete(id string) error
+	List() ([]Change, error)
+}
+
+// MemoryStore keeps nothing; changes are lost on restart
+type MemoryStore struct{}
+
+func (this MemoryStore) Save(change Change) error {
+	return nil
+}
+
+func (this MemoryStore) Delete(id string) error {
+	return nil
+}
+
+func (this MemoryStore) List() ([]Change, error) {
+	return nil, nil
+}
+
+// FileStore writes one json file per change into a directory
+type FileStore struct {
+	files *jsonfile.Dir[Change]
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	files, err := jsonfile.NewDir[Change](dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{files: files}, nil
+}
+
+func (this *FileStore) Save(change Change) error {
+	return this.files.Save(change.Id, change)
+}
+
+func (this *FileStore) Delete(id string) error {
+	return this.files.Delete(id)
+}
+
+func (this *FileStore) List() ([]Change, error) {
+	return this.files.List()
+}
@@ -0,0 +1,313 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/approval"
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/jobs"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/policy"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
+)
+
+var approvals *approval.Manager
+
+// InitApprovals starts the four-eyes workflow if Config.ApprovalKinds or Config.ApprovalProtectedGroups is set
+func InitApprovals(ctx context.Context) {
+	if len(Config.ApprovalKinds) == 0 && !Config.ApprovalProtectedGroups {
+		return
+	}
+	ttl, err := time.ParseDuration(Config.ApprovalTtl)
+	if err != nil {
+		log.Fatal("ERROR: invalid ApprovalTtl ", err)
+	}
+	var store approval.Store = approval.MemoryStore{}
+	if Config.ApprovalStoreDir != "" {
+		store, err = approval.NewFileStore(Config.ApprovalStoreDir)
+		if err != nil {
+			log.Fatal("ERROR: unable to open approval store ", err)
+		}
+	}
+	manager, err := approval.NewManager(store, ttl)
+	if err != nil {
+		log.Fatal("ERROR: unable to load approvals ", err)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				manager.Cleanup(ttl)
+			}
+		}
+	}()
+	approvals = manager
+}
+
+// approvalReason returns why the command has to be approved by a second administrator, or an empty string
+func approvalReason(t tenant.Tenant, cmd PermCommandMsg) string {
+	if approvals == nil {
+		return ""
+	}
+	if Config.ApprovalProtectedGroups && cmd.User == "" && getPolicyOf(t).Config().IsProtectedGroup(cmd.Group) {
+		return "change of the protected group " + cmd.Group
+	}
+	if cmd.Command != model.CommandPut || !strings.ContainsAny(cmd.Right, Config.ApprovalRights) {
+		return ""
+	}
+	if slices.Contains(Config.ApprovalKinds, cmd.Kind) || slices.Contains(Config.ApprovalKinds, "*") {
+		return "right " + model.NormalizeRight(cmd.Right) + " on " + cmd.Kind + " " + cmd.Resource
+	}
+	return ""
+}
+
+// approvalReasons returns why commands have to be approved, empty if none has to be
+func approvalReasons(t tenant.Tenant, msgs []PermCommandMsg) (reasons []string) {
+	for _, msg := range msgs {
+		if reason := approvalReason(t, msg); reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// parkIfRequired submits the commands as pending change and responds with 202 if one of them requires approval.
+// The If-Match header of the request is checked before parking and stored with the change to be checked again on approval;
+// with If-Match all commands have to target the resource of the first one.
+func parkIfRequired(res http.ResponseWriter, r *http.Request, token auth.Token, msgs []PermCommandMsg) (parked bool) {
+	t, err := getTenant(token)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return true
+	}
+	reasons := approvalReasons(t, msgs)
+	commands := []model.Command{}
+	for _, msg := range msgs {
+		commands = append(commands, model.Command{Command: msg.Command, Kind: msg.Kind, Resource: msg.Resource, User: msg.User, Group: msg.Group, Right: msg.Right})
+	}
+	if len(reasons) == 0 {
+		return false
+	}
+	ifMatch := r.Header.Get("If-Match")
+	done, err := checkVersion(ifMatch, token, msgs[0].Kind, msgs[0].Resource)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return true
+	}
+	done(false)
+	change, err := approvals.Submit(t.Name, token.GetUserId(), isAdmin(token), commands, reasons, ifMatch)
+	if err != nil {
+		problem.WriteInternal(res, r, http.StatusInternalServerError, problem.Internal, err)
+		return true
+	}
+	log.Println("change", change.Id, "of", change.Requester, "waits for approval:", strings.Join(reasons, ", "))
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Location", "/approvals/"+change.Id)
+	res.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(res).Encode(change)
+	return true
+}
+
+// parkPlanIfRequired hands the commands of a job plan over to a pending change if one of them requires approval,
+// so that jobs like group migrations can not bypass the four-eyes principle; the job is finished as parked
+func parkPlanIfRequired(t tenant.Tenant, token auth.Token, plan jobs.Plan) jobs.Plan {
+	return func(ctx context.Context) ([]model.Command, error) {
+		commands, err := plan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		msgs := []PermCommandMsg{}
+		for _, command := range commands {
+			msgs = append(msgs, CommandFromModel(command))
+		}
+		reasons := approvalReasons(t, msgs)
+		if len(reasons) == 0 {
+			return commands, nil
+		}
+		change, err := approvals.Submit(t.Name, token.GetUserId(), isAdmin(token), commands, reasons, "")
+		if err != nil {
+			return nil, err
+		}
+		log.Println("commands of job of", change.Requester, "wait for approval as change", change.Id+":", strings.Join(reasons, ", "))
+		return nil, jobs.Parked{Change: change.Id}
+	}
+}
+
+func getApprovals() (*approval.Manager, error) {
+	if approvals == nil {
+		return nil, problem.New(http.StatusNotFound, problem.NotFound, "approvals are not enabled")
+	}
+	return approvals, nil
+}
+
+// isVisible is true for changes of the tenant of the token which were requested by the token user or if the token is an admin
+func isVisible(token auth.Token, change approval.Change) bool {
+	t, err := getTenant(token)
+	if err != nil || change.Tenant != t.Name {
+		return false
+	}
+	return isAdmin(token) || change.Requester == token.GetUserId()
+}
+
+func handleListApprovals(res http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetParsedToken(r)
+	if err != nil {
+		problem.Write(res, r, http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
+		return
+	}
+	manager, err := getApprovals()
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	result := []approval.Change{}
+	for _, change := range manager.List(r.URL.Query().Get("status")) {
+		if isVisible(token, change) {
+			result = append(result, change)
+		}
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(result)
+}
+
+func handleGetApproval(res http.ResponseWriter, r *http.Request, id string) {
+	token, err := auth.GetParsedToken(r)
+	if err != nil {
+		problem.Write(res, r, http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
+		return
+	}
+	manager, err := getApprovals()
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	change, err := manager.Get(id)
+	if err != nil || !isVisible(token, change) {
+		problem.Write(res, r, http.StatusNotFound, problem.NotFound, "unknown change "+id)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(change)
+}
+
+type ApprovalDecision struct {
+	Comment string `json:"comment"`
+}
+
+// handleDecision approves or rejects a pending change; only admins of the same tenant other than the requester may decide
+// recheckChange evaluates the policy for the requester and authorizes the approver again before an approved change is
+// published, because rights and policy may have changed while the change was pending. The token of the requester has
+// usually expired by then, so the approver, who publishes the change, has to hold the administration right.
+func recheckChange(t tenant.Tenant, approver auth.Token, change approval.Change) error {
+	for i, command := range change.Commands {
+		msg := CommandFromModel(command)
+		err := checkPolicy(t, policy.Request{UserId: change.Requester, IsAdmin: change.RequesterAdmin, Command: msg})
+		if err == nil {
+			err = AuthorizeCommand(approver, msg)
+		}
+		if err != nil {
+			return withIndex(err, i)
+		}
+	}
+	return nil
+}
+
+func handleDecision(res http.ResponseWriter, r *http.Request, id string, approve bool) {
+	token, err := getTenantAdminToken(r)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	manager, err := getApprovals()
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	change, err := manager.Get(id)
+	if err != nil || !isVisible(token, change) {
+		problem.Write(res, r, http.StatusNotFound, problem.NotFound, "unknown change "+id)
+		return
+	}
+	t, err := getTenantByName(change.Tenant)
+	if err != nil {
+		problem.WriteInternal(res, r, http.StatusInternalServerError, problem.Internal, err)
+		return
+	}
+	decision := ApprovalDecision{}
+	if r.ContentLength != 0 {
+		err = json.NewDecoder(r.Body).Decode(&decision)
+		if err != nil {
+			problem.Write(res, r, http.StatusBadRequest, problem.ValidationFailed, "invalid json")
+			return
+		}
+	}
+	if approve {
+		change, err = manager.Approve(id, token.GetUserId(), decision.Comment, func(change approval.Change) (published int, err error) {
+			err = recheckChange(t, token, change)
+			if err != nil {
+				return 0, err
+			}
+			done, err := checkVersion(change.IfMatch, token, change.Commands[0].Kind, change.Commands[0].Resource)
+			if err != nil {
+				return 0, err
+			}
+			for _, command := range change.Commands {
+				err = sendTenantEvent(t, CommandFromModel(command))
+				done(err == nil || published > 0)
+				if err != nil {
+					return published, err
+				}
+				published++
+			}
+			return published, nil
+		})
+	} else {
+		change, err = manager.Reject(id, token.GetUserId(), decision.Comment)
+	}
+	var p problem.Problem
+	switch {
+	case errors.As(err, &p):
+		//e.g. the resource changed since the If-Match of the request
+		problem.WriteError(res, r, p)
+	case errors.Is(err, approval.ErrNotFound):
+		problem.Write(res, r, http.StatusNotFound, problem.NotFound, "unknown change "+id)
+	case errors.Is(err, approval.ErrOwnChange):
+		problem.Write(res, r, http.StatusForbidden, problem.FourEyesRequired, "changes have to be decided by another administrator")
+	case errors.Is(err, approval.ErrNotPending):
+		problem.Write(res, r, http.StatusConflict, problem.ApprovalStateConflict, "change "+id+" is not pending")
+	case err != nil:
+		problem.WriteInternal(res, r, http.StatusInternalServerError, problem.PublishFailed, err)
+	default:
+		log.Println("change", change.Id, "of", change.Requester, change.Status, "by", change.Decider)
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(change)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/approval"
+	"github.com/SENERGY-Platform/permission-command/lib/jobs"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/policy"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
+)
+
+func setupApprovals(t *testing.T, kinds ...string) *approval.Manager {
+	err := LoadConfig("../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Config.ApprovalKinds = kinds
+	manager, err := approval.NewManager(approval.MemoryStore{}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approvals = manager
+	t.Cleanup(func() {
+		approvals = nil
+	})
+	return manager
+}
+
+func TestJobsRequireApproval(t *testing.T) {
+	manager := setupApprovals(t, "devices")
+	token := testToken(t, "admin", "admin")
+	grant := model.Command{Command: model.CommandPut, Kind: "devices", Resource: "d1", Group: "target", Right: "rwxa"}
+	removal := model.Command{Command: model.CommandDelete, Kind: "devices", Resource: "d1", Group: "source"}
+
+	plan := parkPlanIfRequired(tenant.Tenant{}, token, func(ctx context.Context) ([]model.Command, error) {
+		return []model.Command{grant, removal}, nil
+	})
+	commands, err := plan(context.Background())
+	var parked jobs.Parked
+	if !errors.As(err, &parked) || commands != nil {
+		t.Fatalf("expected parked plan, got %v %v", commands, err)
+	}
+	change, err := manager.Get(parked.Change)
+	if err != nil || change.Status != approval.StatusPending || change.Requester != "admin" || len(change.Commands) != 2 {
+		t.Fatalf("expected pending change with all commands of the job, got %+v %v", change, err)
+	}
+
+	plan = parkPlanIfRequired(tenant.Tenant{}, token, func(ctx context.Context) ([]model.Command, error) {
+		return []model.Command{removal}, nil
+	})
+	commands, err = plan(context.Background())
+	if err != nil || len(commands) != 1 {
+		t.Fatalf("expected commands without approval to be returned, got %v %v", commands, err)
+	}
+}
+
+func TestImportIsExemptFromApproval(t *testing.T) {
+	manager := setupApprovals(t, "*")
+	body := `{"command": "PUT", "kind": "devices", "resource": "d1", "group": "g1", "right": "rwxa"}` + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/admin/import?dry_run=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Authorization", testToken(t, "admin", "admin").Token)
+	res := httptest.NewRecorder()
+	handleImport(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatal("expected import, got", res.Code, res.Body.String())
+	}
+	progress := ImportProgress{}
+	err := json.Unmarshal([]byte(strings.Split(res.Body.String(), "\n")[0]), &progress)
+	if err != nil || progress.Status != "validated" || progress.Total != 1 {
+		t.Errorf("unexpected progress %v %v", res.Body.String(), err)
+	}
+	if len(manager.List("")) != 0 {
+		t.Error("imports must not be parked")
+	}
+}
+
+func approveChange(t *testing.T, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/approvals/"+id+"/approve", nil)
+	req.Header.Set("Authorization", testToken(t, "approver", "admin").Token)
+	res := httptest.NewRecorder()
+	handleDecision(res, req, id, true)
+	return res
+}
+
+func TestApprovalRechecksPolicy(t *testing.T) {
+	manager := setupApprovals(t, "devices")
+	transport := setupPublisher(t)
+	grant := model.Command{Command: model.CommandPut, Kind: "devices", Resource: "d1", Group: "g1", Right: "rwxa"}
+	change, err := manager.Submit("", "requester", false, []model.Command{grant}, []string{"test"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usePolicy(t, policy.Config{DeniedGroups: []string{"g1"}})
+
+	res := approveChange(t, change.Id)
+	if res.Code != http.StatusForbidden || !strings.Contains(res.Body.String(), "denied-principal") {
+		t.Fatal("expected policy violation, got", res.Code, res.Body.String())
+	}
+	change, _ = manager.Get(change.Id)
+	if change.Status != approval.StatusFailed || transport.calls.Load() != 0 {
+		t.Errorf("expected failed change without publishing, got %+v", change)
+	}
+}
+
+func TestApprovalRechecksAuthorization(t *testing.T) {
+	manager := setupApprovals(t, "devices")
+	transport := setupPublisher(t)
+	permSearch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer permSearch.Close()
+	Config.PermissionsViewUrl = permSearch.URL
+	grant := model.Command{Command: model.CommandPut, Kind: "devices", Resource: "d1", Group: "g1", Right: "rwxa"}
+	change, err := manager.Submit("", "requester", false, []model.Command{grant}, []string{"test"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := approveChange(t, change.Id)
+	if res.Code != http.StatusForbidden || !strings.Contains(res.Body.String(), string(problem.NotResourceAdmin)) {
+		t.Fatal("expected missing administration right, got", res.Code, res.Body.String())
+	}
+	change, _ = manager.Get(change.Id)
+	if change.Status != approval.StatusFailed || transport.calls.Load() != 0 {
+		t.Errorf("expected failed change without publishing, got %+v", change)
+	}
+}
@@ -34,6 +34,7 @@ func GetParsedToken(req *http.Request) (token Token, err error) {
 type Token struct {
 	Token       string              `json:"-"`
 	Sub         string              `json:"sub,omitempty"`
+	Issuer      string              `json:"iss,omitempty"`
 	RealmAccess map[string][]string `json:"realm_access,omitempty"`
 }
 
@@ -52,6 +53,11 @@ func (this *Token) Valid() error {
 	return nil
 }
 
+// Parse parses the claims of an Authorization header value without verifying the signature
+func Parse(token string) (claims Token, err error) {
+	return parse(token)
+}
+
 func parse(token string) (claims Token, err error) {
 	orig := token
 	if len(token) > 7 && strings.ToLower(token[:7]) == "bearer " {
@@ -64,8 +70,23 @@ func parse(token string) (claims Token, err error) {
 	return
 }
 
+// Claims returns all claims of the token, not only the ones known to Token
+func (this *Token) Claims() (map[string]interface{}, error) {
+	token := this.Token
+	if len(token) > 7 && strings.ToLower(token[:7]) == "bearer " {
+		token = token[7:]
+	}
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(token, claims)
+	return claims, err
+}
+
 func (this *Token) IsAdmin() bool {
-	return contains(this.RealmAccess["roles"], "admin")
+	return this.HasRole("admin")
+}
+
+func (this *Token) HasRole(role string) bool {
+	return contains(this.RealmAccess["roles"], role)
 }
 
 func (this *Token) GetUserId() string {
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func encodeBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func TestKeySetVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests++
+		json.NewEncoder(res).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kid": "rsa", "kty": "RSA", "use": "sig", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+			{"kid": "ec", "kty": "EC", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)},
+			{"kid": "enc", "kty": "RSA", "use": "enc", "n": encodeBigInt(otherKey.N), "e": encodeBigInt(big.NewInt(int64(otherKey.E)))},
+		}})
+	}))
+	defer server.Close()
+	keys := NewKeySet(server.URL, server.Client())
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, exp time.Time) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "u1", "exp": exp.Unix()})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + signed
+	}
+	valid := time.Now().Add(time.Hour)
+
+	for name, token := range map[string]string{
+		"rsa": sign(jwt.SigningMethodRS256, "rsa", rsaKey, valid),
+		"ec":  sign(jwt.SigningMethodES256, "ec", ecKey, valid),
+	} {
+		err = keys.Verify(token)
+		if err != nil {
+			t.Errorf("%v: expected valid token, got %v", name, err)
+		}
+	}
+	for name, token := range map[string]string{
+		"other key":       sign(jwt.SigningMethodRS256, "rsa", otherKey, valid),
+		"encryption key":  sign(jwt.SigningMethodRS256, "enc", otherKey, valid),
+		"unknown kid":     sign(jwt.SigningMethodRS256, "unknown", rsaKey, valid),
+		"expired":         sign(jwt.SigningMethodRS256, "rsa", rsaKey, time.Now().Add(-time.Minute)),
+		"hmac":            sign(jwt.SigningMethodHS256, "rsa", []byte("secret"), valid),
+		"none":            sign(jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType, valid),
+		"wrong algorithm": sign(jwt.SigningMethodES256, "rsa", ecKey, valid),
+		"malformed":       "Bearer foo.bar.baz",
+	} {
+		err = keys.Verify(token)
+		if err == nil || errors.Is(err, ErrKeysUnavailable) {
+			t.Errorf("%v: expected invalid token, got %v", name, err)
+		}
+	}
+	if requests != 1 {
+		t.Error("expected unknown key ids to reload the keys at most every", keyReloadInterval, "got requests:", requests)
+	}
+}
+
+func TestKeySetUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "u1"}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewKeySet(server.URL, server.Client()).Verify(token)
+	if !errors.Is(err, ErrKeysUnavailable) {
+		t.Error("expected ErrKeysUnavailable, got", err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientCredentials requests and caches tokens of the service account via the openid client credentials grant
+type ClientCredentials struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	mux          sync.Mutex
+	token        string
+	expiry       time.Time
+}
+
+func NewClientCredentials(tokenUrl string, clientId string, clientSecret string) *ClientCredentials {
+	return &ClientCredentials{tokenUrl: tokenUrl, clientId: clientId, clientSecret: clientSecret}
+}
+
+type openidToken struct {
+	AccessToken string  `json:"access_token"`
+	ExpiresIn   float64 `json:"expires_in"`
+}
+
+// Token returns an Authorization header value, requesting a new token shortly before the cached one expires
+func (this *ClientCredentials) Token() (string, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.token != "" && time.Now().Add(30*time.Second).Before(this.expiry) {
+		return this.token, nil
+	}
+	if this.tokenUrl == "" {
+		return "", errors.New("missing token url for client credentials")
+	}
+	resp, err := http.PostForm(this.tokenUrl, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {this.clientId},
+		"client_secret": {this.clientSecret},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("token request failed with %v: %v", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	token := openidToken{}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+	this.token = "Bearer " + token.AccessToken
+	this.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return this.token, nil
+}
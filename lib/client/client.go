@@ -0,0 +1,233 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/idempotency"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/roles"
+)
+
+type Command = model.Command
+
+// Interface is implemented by Client and Fake, consumers should depend on it to be able to use the Fake in their tests
+type Interface interface {
+	SetUserRight(ctx context.Context, kind string, resource string, user string, right string) error
+	SetGroupRight(ctx context.Context, kind string, resource string, group string, right string) error
+	DeleteUserRight(ctx context.Context, kind string, resource string, user string) error
+	DeleteGroupRight(ctx context.Context, kind string, resource string, group string) error
+	Batch(ctx context.Context, commands []Command) error
+}
+
+// TokenProvider returns the Authorization header value used for requests without a token in their context
+type TokenProvider func(ctx context.Context) (string, error)
+
+type Client struct {
+	baseUrl       string
+	httpClient    *http.Client
+	tokenProvider TokenProvider
+	maxRetries    int
+	retryDelay    time.Duration
+}
+
+type Option func(*Client)
+
+// WithToken uses the same token for every request
+func WithToken(token string) Option {
+	return func(client *Client) {
+		client.tokenProvider = func(ctx context.Context) (string, error) {
+			return token, nil
+		}
+	}
+}
+
+func WithTokenProvider(provider TokenProvider) Option {
+	return func(client *Client) {
+		client.tokenProvider = provider
+	}
+}
+
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = httpClient
+	}
+}
+
+// WithRetries configures how often requests failing with a network error or 5xx status are repeated;
+// the delay doubles with every attempt. Writes are repeated with the same Idempotency-Key, so they are published only once.
+func WithRetries(maxRetries int, initialDelay time.Duration) Option {
+	return func(client *Client) {
+		client.maxRetries = maxRetries
+		client.retryDelay = initialDelay
+	}
+}
+
+func New(baseUrl string, options ...Option) *Client {
+	result := &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		maxRetries: 3,
+		retryDelay: 200 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(result)
+	}
+	return result
+}
+
+type tokenKey struct{}
+
+// ContextWithToken overrides the token provider for requests using the returned context
+func ContextWithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+func (this *Client) SetUserRight(ctx context.Context, kind string, resource string, user string, right string) error {
+	return this.do(ctx, http.MethodPut, rightPath("user", user, kind, resource, right), nil, nil)
+}
+
+func (this *Client) SetGroupRight(ctx context.Context, kind string, resource string, group string, right string) error {
+	return this.do(ctx, http.MethodPut, rightPath("group", group, kind, resource, right), nil, nil)
+}
+
+func (this *Client) DeleteUserRight(ctx context.Context, kind string, resource string, user string) error {
+	return this.do(ctx, http.MethodDelete, rightPath("user", user, kind, resource, ""), nil, nil)
+}
+
+func (this *Client) DeleteGroupRight(ctx context.Context, kind string, resource string, group string) error {
+	return this.do(ctx, http.MethodDelete, rightPath("group", group, kind, resource, ""), nil, nil)
+}
+
+func (this *Client) Batch(ctx context.Context, commands []Command) error {
+	body, err := json.Marshal(commands)
+	if err != nil {
+		return err
+	}
+	return this.do(ctx, http.MethodPost, "/batch", body, nil)
+}
+
+// Roles returns the roles the service accepts in place of right strings for the kind
+func (this *Client) Roles(ctx context.Context, kind string) (result []roles.Role, err error) {
+	byKind := map[string][]roles.Role{}
+	err = this.do(ctx, http.MethodGet, "/roles?kind="+url.QueryEscape(kind), nil, &byKind)
+	return byKind[kind], err
+}
+
+func rightPath(principalType string, principal string, kind string, resource string, right string) string {
+	path := "/" + principalType + "/" + url.PathEscape(principal) + "/" + url.PathEscape(kind) + "/" + url.PathEscape(resource)
+	if right != "" {
+		path = path + "/" + url.PathEscape(right)
+	}
+	return path
+}
+
+func (this *Client) token(ctx context.Context) (string, error) {
+	if token, ok := ctx.Value(tokenKey{}).(string); ok {
+		return token, nil
+	}
+	if this.tokenProvider == nil {
+		return "", errors.New("missing token: use WithToken, WithTokenProvider or ContextWithToken")
+	}
+	return this.tokenProvider(ctx)
+}
+
+// do sends the request and, if result is not nil, decodes the json response into result.
+// All attempts of a write share one Idempotency-Key.
+func (this *Client) do(ctx context.Context, method string, path string, body []byte, result interface{}) (err error) {
+	token, err := this.token(ctx)
+	if err != nil {
+		return err
+	}
+	key := ""
+	if method != http.MethodGet {
+		key, err = newIdempotencyKey()
+		if err != nil {
+			return err
+		}
+	}
+	delay := this.retryDelay
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = this.try(ctx, method, path, body, token, key, result)
+		if !retry || attempt >= this.maxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = delay * 2
+	}
+}
+
+func (this *Client) try(ctx context.Context, method string, path string, body []byte, token string, key string, result interface{}) (retry bool, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, this.baseUrl+path, reader)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", token)
+	if key != "" {
+		req.Header.Set(idempotency.Header, key)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := this.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusAccepted {
+		return false, readApprovalPending(resp)
+	}
+	if resp.StatusCode < 300 && result != nil {
+		return false, json.NewDecoder(resp.Body).Decode(result)
+	}
+	if resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	err = readError(resp)
+	// a previous attempt with the same key may still be running
+	return resp.StatusCode >= 500 || errors.Is(err, ErrIdempotencyKeyInUse), err
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
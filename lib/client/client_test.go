@@ -0,0 +1,94 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+func TestApprovalPending(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/approvals/change-1")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":"change-1","status":"pending"}`))
+	}))
+	defer server.Close()
+
+	err := New(server.URL, WithToken("Bearer token")).SetUserRight(context.Background(), "devices", "d1", "u1", "rwxa")
+	if !errors.Is(err, ErrApprovalPending) {
+		t.Fatalf("expected ErrApprovalPending, got %v", err)
+	}
+	var pending *ApprovalPendingError
+	if !errors.As(err, &pending) || pending.ChangeId != "change-1" {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	if errors.Is(err, ErrInternal) {
+		t.Fatal("pending approval should not match problem codes")
+	}
+}
+
+func TestRetriesReuseIdempotencyKey(t *testing.T) {
+	keys := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		switch len(keys) {
+		case 1:
+			problem.Write(w, r, http.StatusBadGateway, problem.PublishFailed, "kafka unavailable")
+		case 2:
+			problem.Write(w, r, http.StatusConflict, problem.IdempotencyKeyInUse, "in progress")
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithToken("Bearer token"), WithRetries(3, time.Millisecond))
+	err := c.Batch(context.Background(), []Command{{Command: "PUT", Kind: "devices", Resource: "d1", User: "u1", Right: "r"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[0] == "" || keys[1] != keys[0] || keys[2] != keys[0] {
+		t.Fatal("expected all attempts with the same key, got", keys)
+	}
+
+	err = c.Batch(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys[3] == keys[0] {
+		t.Error("expected a new key for every call")
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusPreconditionFailed, problem.VersionMismatch, "changed")
+	}))
+	defer server.Close()
+
+	err := New(server.URL, WithToken("Bearer token")).SetUserRight(context.Background(), "devices", "d1", "u1", "r")
+	if !errors.Is(err, ErrVersionMismatch) || errors.Is(err, ErrPolicyViolation) {
+		t.Fatal("expected ErrVersionMismatch, got", err)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+// Error is returned for every non 2xx response; use errors.Is with the Err* values to check the error code
+type Error struct {
+	StatusCode int
+	Problem    problem.Problem
+}
+
+func (this *Error) Error() string {
+	return "permission-command: " + this.Problem.Error()
+}
+
+// Is matches errors with the same problem code
+func (this *Error) Is(target error) bool {
+	other, ok := target.(*Error)
+	return ok && other.Problem.Code == this.Problem.Code
+}
+
+func codeError(code problem.Code) *Error {
+	return &Error{Problem: problem.Problem{Code: code}}
+}
+
+var (
+	ErrInvalidToken          = codeError(problem.InvalidToken)
+	ErrValidationFailed      = codeError(problem.ValidationFailed)
+	ErrBodyTooLarge          = codeError(problem.BodyTooLarge)
+	ErrSelfAdminRemoval      = codeError(problem.SelfAdminRemoval)
+	ErrAdminGroupProtected   = codeError(problem.AdminGroupProtected)
+	ErrPolicyViolation       = codeError(problem.PolicyViolation)
+	ErrNotResourceAdmin      = codeError(problem.NotResourceAdmin)
+	ErrAdminRoleRequired     = codeError(problem.AdminRoleRequired)
+	ErrPermissionCheckFailed = codeError(problem.PermissionCheckFailed)
+	ErrPublishFailed         = codeError(problem.PublishFailed)
+	ErrProjectionUnavailable = codeError(problem.ProjectionUnavailable)
+	ErrFourEyesRequired      = codeError(problem.FourEyesRequired)
+	ErrApprovalStateConflict = codeError(problem.ApprovalStateConflict)
+	ErrUnknownTenant         = codeError(problem.UnknownTenant)
+	ErrTenantNotSupported    = codeError(problem.TenantNotSupported)
+	ErrVersionMismatch       = codeError(problem.VersionMismatch)
+	ErrIdempotencyKeyReused  = codeError(problem.IdempotencyKeyReused)
+	ErrIdempotencyKeyInUse   = codeError(problem.IdempotencyKeyInUse)
+	ErrNotFound              = codeError(problem.NotFound)
+	ErrInternal              = codeError(problem.Internal)
+)
+
+// ApprovalPendingError is returned when the service parked the commands as a change waiting for the approval of a
+// second administrator (202); nothing has been published yet
+type ApprovalPendingError struct {
+	ChangeId string
+}
+
+func (this *ApprovalPendingError) Error() string {
+	return "permission-command: change " + this.ChangeId + " waits for approval"
+}
+
+// Is matches every ApprovalPendingError, use errors.As to read the change id
+func (this *ApprovalPendingError) Is(target error) bool {
+	_, ok := target.(*ApprovalPendingError)
+	return ok
+}
+
+var ErrApprovalPending = &ApprovalPendingError{}
+
+func readApprovalPending(resp *http.Response) error {
+	change := struct {
+		Id string `json:"id"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(body, &change) != nil || change.Id == "" {
+		change.Id = strings.TrimPrefix(resp.Header.Get("Location"), "/approvals/")
+	}
+	return &ApprovalPendingError{ChangeId: change.Id}
+}
+
+func readError(resp *http.Response) error {
+	result := &Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), problem.ContentType) && json.Unmarshal(body, &result.Problem) == nil {
+		return result
+	}
+	// responses of older service versions or proxies
+	result.Problem = problem.New(resp.StatusCode, problem.Internal, strings.TrimSpace(string(body)))
+	return result
+}
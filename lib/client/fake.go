@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+// Fake is an in-memory Interface implementation for unit tests of consumers.
+// It records all commands and keeps the resulting rights per kind, resource and user/group.
+type Fake struct {
+	mux      sync.Mutex
+	commands []Command
+	users    map[string]map[string]map[string]string
+	groups   map[string]map[string]map[string]string
+	err      error
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		users:  map[string]map[string]map[string]string{},
+		groups: map[string]map[string]map[string]string{},
+	}
+}
+
+// FailWith makes every following call return err without recording the command; nil resets the behavior
+func (this *Fake) FailWith(err error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.err = err
+}
+
+func (this *Fake) SetUserRight(ctx context.Context, kind string, resource string, user string, right string) error {
+	return this.Batch(ctx, []Command{{Command: model.CommandPut, Kind: kind, Resource: resource, User: user, Right: right}})
+}
+
+func (this *Fake) SetGroupRight(ctx context.Context, kind string, resource string, group string, right string) error {
+	return this.Batch(ctx, []Command{{Command: model.CommandPut, Kind: kind, Resource: resource, Group: group, Right: right}})
+}
+
+func (this *Fake) DeleteUserRight(ctx context.Context, kind string, resource string, user string) error {
+	return this.Batch(ctx, []Command{{Command: model.CommandDelete, Kind: kind, Resource: resource, User: user}})
+}
+
+func (this *Fake) DeleteGroupRight(ctx context.Context, kind string, resource string, group string) error {
+	return this.Batch(ctx, []Command{{Command: model.CommandDelete, Kind: kind, Resource: resource, Group: group}})
+}
+
+func (this *Fake) Batch(ctx context.Context, commands []Command) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.err != nil {
+		return this.err
+	}
+	for _, command := range commands {
+		if (command.User == "") == (command.Group == "") || command.Kind == "" || command.Resource == "" {
+			return &Error{StatusCode: http.StatusBadRequest, Problem: problem.New(http.StatusBadRequest, problem.ValidationFailed, "invalid command")}
+		}
+	}
+	for _, command := range commands {
+		this.commands = append(this.commands, command)
+		if command.User != "" {
+			apply(this.users, command, command.User)
+		} else {
+			apply(this.groups, command, command.Group)
+		}
+	}
+	return nil
+}
+
+func apply(state map[string]map[string]map[string]string, command Command, principal string) {
+	if _, ok := state[command.Kind]; !ok {
+		state[command.Kind] = map[string]map[string]string{}
+	}
+	if _, ok := state[command.Kind][command.Resource]; !ok {
+		state[command.Kind][command.Resource] = map[string]string{}
+	}
+	if command.Command == model.CommandDelete {
+		delete(state[command.Kind][command.Resource], principal)
+	} else {
+		state[command.Kind][command.Resource][principal] = command.Right
+	}
+}
+
+// Commands returns all successfully applied commands in order
+func (this *Fake) Commands() []Command {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return append([]Command{}, this.commands...)
+}
+
+// UserRight returns the right of the user and false if the user has no entry for the resource
+func (this *Fake) UserRight(kind string, resource string, user string) (string, bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	right, ok := this.users[kind][resource][user]
+	return right, ok
+}
+
+// GroupRight returns the right of the group and false if the group has no entry for the resource
+func (this *Fake) GroupRight(kind string, resource string, group string) (string, bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	right, ok := this.groups[kind][resource][group]
+	return right, ok
+}
+
+var _ Interface = &Fake{}
+var _ Interface = &Client{}
@@ -0,0 +1,243 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package commandfile reads and writes lists of permission commands as csv, json lines or yaml
+package commandfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	Csv   Format = "csv"
+	Jsonl Format = "jsonl"
+	Yaml  Format = "yaml"
+)
+
+var CsvHeader = []string{"command", "kind", "resource", "user", "group", "right"}
+
+// FormatOf derives the format from a file name or content type
+func FormatOf(fileNameOrContentType string) (Format, error) {
+	s := strings.ToLower(fileNameOrContentType)
+	switch {
+	case strings.HasSuffix(s, ".csv") || strings.Contains(s, "text/csv"):
+		return Csv, nil
+	case strings.HasSuffix(s, ".jsonl") || strings.HasSuffix(s, ".ndjson") || strings.Contains(s, "ndjson") || strings.Contains(s, "jsonl"):
+		return Jsonl, nil
+	case strings.HasSuffix(s, ".yaml") || strings.HasSuffix(s, ".yml") || strings.Contains(s, "yaml"):
+		return Yaml, nil
+	default:
+		return "", errors.New("unknown format, expected csv, jsonl or yaml")
+	}
+}
+
+func Read(reader io.Reader, format Format) ([]model.Command, error) {
+	switch format {
+	case Csv:
+		return ReadCsv(reader)
+	case Jsonl:
+		return ReadJsonl(reader)
+	case Yaml:
+		commands := []model.Command{}
+		err := yaml.NewDecoder(reader).Decode(&commands)
+		if err == io.EOF {
+			err = nil
+		}
+		return commands, err
+	default:
+		return nil, fmt.Errorf("unknown format %v", format)
+	}
+}
+
+// ReadCsv expects a header row naming the columns command, kind, resource, user, group and right in any order
+func ReadCsv(reader io.Reader) (commands []model.Command, err error) {
+	r, err := newCsvReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return readAll(r)
+}
+
+// ReadJsonl reads one json encoded command per line; empty lines are skipped
+func ReadJsonl(reader io.Reader) (commands []model.Command, err error) {
+	return readAll(newJsonlReader(reader))
+}
+
+// Reader reads commands one by one, so large lists do not have to be held in memory; Read returns io.EOF after the last command
+type Reader interface {
+	Read() (model.Command, error)
+}
+
+// NewReader streams csv and json lines; yaml can only be read as a whole
+func NewReader(reader io.Reader, format Format) (Reader, error) {
+	switch format {
+	case Csv:
+		return newCsvReader(reader)
+	case Jsonl:
+		return newJsonlReader(reader), nil
+	default:
+		return nil, fmt.Errorf("format %v can not be streamed", format)
+	}
+}
+
+func readAll(reader Reader) (commands []model.Command, err error) {
+	for {
+		command, err := reader.Read()
+		if err == io.EOF {
+			return commands, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCsvReader reads the header row
+func newCsvReader(reader io.Reader) (*csvReader, error) {
+	r := csv.NewReader(reader)
+	r.TrimLeadingSpace = true
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"command", "kind", "resource"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing csv column %v", required)
+		}
+	}
+	return &csvReader{reader: r, columns: columns}, nil
+}
+
+func (this *csvReader) Read() (model.Command, error) {
+	record, err := this.reader.Read()
+	if err != nil {
+		return model.Command{}, err
+	}
+	get := func(name string) string {
+		i, ok := this.columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	return model.Command{
+		Command:  strings.ToUpper(get("command")),
+		Kind:     get("kind"),
+		Resource: get("resource"),
+		User:     get("user"),
+		Group:    get("group"),
+		Right:    get("right"),
+	}, nil
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJsonlReader(reader io.Reader) *jsonlReader {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &jsonlReader{scanner: scanner}
+}
+
+func (this *jsonlReader) Read() (command model.Command, err error) {
+	for this.scanner.Scan() {
+		this.line++
+		text := bytes.TrimSpace(this.scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		err = json.Unmarshal(text, &command)
+		if err != nil {
+			return command, fmt.Errorf("line %v: %w", this.line, err)
+		}
+		return command, nil
+	}
+	err = this.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return command, err
+}
+
+// Writer writes commands one by one, so large lists can be streamed
+type Writer interface {
+	Write(command model.Command) error
+	Flush() error
+}
+
+func NewWriter(out io.Writer, format Format) (Writer, error) {
+	switch format {
+	case Csv:
+		w := csv.NewWriter(out)
+		err := w.Write(CsvHeader)
+		return &csvWriter{writer: w}, err
+	case Jsonl:
+		return &jsonlWriter{encoder: json.NewEncoder(out)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %v", format)
+	}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (this *csvWriter) Write(command model.Command) error {
+	return this.writer.Write([]string{command.Command, command.Kind, command.Resource, command.User, command.Group, command.Right})
+}
+
+func (this *csvWriter) Flush() error {
+	this.writer.Flush()
+	return this.writer.Error()
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (this *jsonlWriter) Write(command model.Command) error {
+	return this.encoder.Encode(command)
+}
+
+func (this *jsonlWriter) Flush() error {
+	return nil
+}
@@ -25,16 +25,90 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/SENERGY-Platform/permission-command/lib/policy"
+	"github.com/SENERGY-Platform/permission-command/lib/roles"
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
 )
 
 type ConfigStruct struct {
-	ServerPort string
-	LogLevel   string
+	ServerPort  string
+	LogLevel    string
+	MaxBodySize int64 //bytes of request bodies except streamed imports, larger bodies are answered with 413; 0 for no limit
 
 	PermissionsViewUrl string
 	KafkaUrl           string
 
-	PermTopic string
+	KafkaTlsEnabled            bool
+	KafkaTlsCaFile             string
+	KafkaTlsCertFile           string
+	KafkaTlsKeyFile            string
+	KafkaTlsInsecureSkipVerify bool
+	KafkaSaslMechanism         string //empty | PLAIN | SCRAM-SHA-256 | SCRAM-SHA-512
+	KafkaSaslUsername          string
+	KafkaSaslPassword          string `config:"secret"`
+
+	KafkaRequiredAcks string //all | one
+	KafkaBatchSize    int64
+	KafkaBatchTimeout string
+	KafkaCompression  string //none | gzip | snappy | lz4 | zstd
+	KafkaWriteTimeout string
+	KafkaMaxAttempts  int64
+
+	AuthTokenUrl     string
+	AuthClientId     string
+	AuthClientSecret string `config:"secret"`
+
+	PermTopic  string
+	KindTopics map[string]string //resource kind -> topic, other kinds use PermTopic
+
+	MessageEncoding    string //json | protobuf
+	CloudEventsEnabled bool   //adds cloudevents binary mode headers
+	CloudEventsSource  string
+
+	TopicProvisioning      string //create | verify | skip
+	TopicMismatch          string //warn | fail
+	TopicPartitions        int64
+	TopicReplicationFactor int64
+	TopicConfig            map[string]string
+
+	ProjectionEnabled          bool
+	ProjectionSnapshotFile     string
+	ProjectionSnapshotInterval string
+
+	Authorizer      string   //permission-search | projection
+	DelegationKinds []string //kinds where users may grant a subset of their own rights without "a", "*" for all
+
+	OpaMode       string //empty | instead | alongside
+	OpaUrl        string //data api url of the decision, e.g. http://opa:8181/v1/data/senergy/permission/allow
+	OpaBundlePath string //rego bundle directory or .tar.gz, evaluated in process instead of asking OpaUrl
+	OpaQuery      string
+	OpaTimeout    string
+
+	Policy *policy.Config //nil protects the admin group only, see policy.DefaultConfig
+	Roles  roles.Config   //kind -> role name -> right, nil defines viewer, executor, editor and owner, see roles.DefaultConfig
+
+	Tenants map[string]tenant.Config //tenant name -> settings, resolved by the token issuer; empty serves every token with the global settings
+
+	ManifestFile          string
+	ManifestCheckInterval string
+
+	ApprovalKinds           []string //kinds where granting ApprovalRights needs a second administrator, "*" for all
+	ApprovalRights          string
+	ApprovalProtectedGroups bool //changes of protected groups need a second administrator
+	ApprovalTtl             string
+	ApprovalStoreDir        string
+
+	IdempotencyStoreDir string
+	IdempotencyTtl      string
+
+	JobStoreDir  string
+	JobWorkers   int64
+	JobRetention string
+
+	ReconcileInterval   string
+	ReconcileRepair     bool
+	ReconcileReportFile string
 }
 
 type ConfigType *ConfigStruct
@@ -54,14 +128,93 @@ func LoadConfig(location string) error {
 		log.Println("invalid config json: ", error)
 		return error
 	}
-	HandleEnvironmentVars(&configuration)
+	error = HandleEnvironmentVars(&configuration)
+	if error != nil {
+		log.Println("invalid config environment: ", error)
+		return error
+	}
 	HandleDefaultValues(&configuration)
 	Config = &configuration
 	return nil
 }
 
 func HandleDefaultValues(config ConfigType) {
-
+	if config.MessageEncoding == "" {
+		config.MessageEncoding = "json"
+	}
+	if config.CloudEventsSource == "" {
+		config.CloudEventsSource = "urn:senergy:permission-command"
+	}
+	if config.KafkaRequiredAcks == "" {
+		config.KafkaRequiredAcks = "all"
+	}
+	if config.KafkaBatchSize == 0 {
+		config.KafkaBatchSize = 1
+	}
+	if config.KafkaBatchTimeout == "" {
+		config.KafkaBatchTimeout = "10ms"
+	}
+	if config.KafkaCompression == "" {
+		config.KafkaCompression = "none"
+	}
+	if config.KafkaWriteTimeout == "" {
+		config.KafkaWriteTimeout = "10s"
+	}
+	if config.KafkaMaxAttempts == 0 {
+		config.KafkaMaxAttempts = 10
+	}
+	if config.TopicProvisioning == "" {
+		config.TopicProvisioning = TopicProvisioningCreate
+	}
+	if config.TopicMismatch == "" {
+		config.TopicMismatch = TopicMismatchWarn
+	}
+	if config.TopicPartitions == 0 {
+		config.TopicPartitions = 1
+	}
+	if config.TopicReplicationFactor == 0 {
+		config.TopicReplicationFactor = 1
+	}
+	if config.TopicConfig == nil {
+		config.TopicConfig = map[string]string{
+			"retention.ms":              "-1",
+			"retention.bytes":           "-1",
+			"cleanup.policy":            "compact",
+			"delete.retention.ms":       "86400000",
+			"segment.ms":                "604800000",
+			"min.cleanable.dirty.ratio": "0.1",
+		}
+	}
+	if config.ProjectionSnapshotInterval == "" {
+		config.ProjectionSnapshotInterval = "1m"
+	}
+	if config.OpaQuery == "" {
+		config.OpaQuery = "data.senergy.permission.allow"
+	}
+	if config.OpaTimeout == "" {
+		config.OpaTimeout = "2s"
+	}
+	if config.Authorizer == "" {
+		config.Authorizer = AuthorizerPermissionSearch
+	}
+	if config.ApprovalRights == "" {
+		config.ApprovalRights = "a"
+	}
+	if config.ApprovalTtl == "" {
+		config.ApprovalTtl = "72h"
+	}
+	if config.IdempotencyTtl == "" {
+		config.IdempotencyTtl = "24h"
+	}
+	if config.JobWorkers == 0 {
+		config.JobWorkers = 2
+	}
+	if config.JobRetention == "" {
+		config.JobRetention = "168h"
+	}
+	if config.ManifestCheckInterval == "" {
+		config.ManifestCheckInterval = "1m"
+	}
 }
 
 var camel = regexp.MustCompile("(^[^A-Z]*|[A-Z]*)([A-Z][^A-Z]+|$)")
@@ -80,19 +233,28 @@ func fieldNameToEnvName(s string) string {
 }
 
 // preparations for docker
-func HandleEnvironmentVars(config ConfigType) {
+func HandleEnvironmentVars(config ConfigType) error {
 	configValue := reflect.Indirect(reflect.ValueOf(config))
 	configType := configValue.Type()
 	for index := 0; index < configType.NumField(); index++ {
-		fieldName := configType.Field(index).Name
+		field := configType.Field(index)
+		fieldName := field.Name
 		envName := fieldNameToEnvName(fieldName)
 		envValue := os.Getenv(envName)
 		if envValue != "" {
-			fmt.Println("use environment variable: ", envName, " = ", envValue)
+			printed := envValue
+			if field.Tag.Get("config") == "secret" {
+				printed = "***"
+			}
+			fmt.Println("use environment variable: ", envName, " = ", printed)
 			if configValue.FieldByName(fieldName).Kind() == reflect.Int64 {
 				i, _ := strconv.ParseInt(envValue, 10, 64)
 				configValue.FieldByName(fieldName).SetInt(i)
 			}
+			if configValue.FieldByName(fieldName).Kind() == reflect.Bool {
+				b, _ := strconv.ParseBool(envValue)
+				configValue.FieldByName(fieldName).SetBool(b)
+			}
 			if configValue.FieldByName(fieldName).Kind() == reflect.String {
 				configValue.FieldByName(fieldName).SetString(envValue)
 			}
@@ -103,6 +265,32 @@ func HandleEnvironmentVars(config ConfigType) {
 				}
 				configValue.FieldByName(fieldName).Set(reflect.ValueOf(val))
 			}
+			if configValue.FieldByName(fieldName).Kind() == reflect.Map {
+				val, err := parseEnvMap(configValue.FieldByName(fieldName).Type(), envValue)
+				if err != nil {
+					return fmt.Errorf("invalid environment variable %v: %w", envName, err)
+				}
+				configValue.FieldByName(fieldName).Set(val)
+			}
 		}
 	}
+	return nil
+}
+
+// parseEnvMap reads "k=v,k=v" into map[string]string fields and json objects into maps of any type
+func parseEnvMap(mapType reflect.Type, envValue string) (reflect.Value, error) {
+	if mapType == reflect.TypeOf(map[string]string{}) && !strings.HasPrefix(strings.TrimSpace(envValue), "{") {
+		val := map[string]string{}
+		for _, element := range strings.Split(envValue, ",") {
+			key, value, _ := strings.Cut(element, "=")
+			val[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		return reflect.ValueOf(val), nil
+	}
+	val := reflect.New(mapType)
+	err := json.Unmarshal([]byte(envValue), val.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return val.Elem(), nil
 }
@@ -0,0 +1,52 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lib
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSecretEnvironmentVarsAreMasked(t *testing.T) {
+	t.Setenv("KAFKA_SASL_PASSWORD", "sasl-secret")
+	t.Setenv("AUTH_CLIENT_SECRET", "client-secret")
+	t.Setenv("KAFKA_SASL_USERNAME", "sasl-user")
+	stdout := os.Stdout
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = writer
+	config := ConfigStruct{}
+	err = HandleEnvironmentVars(&config)
+	os.Stdout = stdout
+	writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := io.ReadAll(reader)
+	if strings.Contains(string(out), "sasl-secret") || strings.Contains(string(out), "client-secret") {
+		t.Error("secrets were printed:", string(out))
+	}
+	if !strings.Contains(string(out), "sasl-user") {
+		t.Error("expected other values to be printed:", string(out))
+	}
+	if config.KafkaSaslPassword != "sasl-secret" || config.AuthClientSecret != "client-secret" {
+		t.Errorf("expected secrets to be set, got %+v", config)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+// RightsChecker is implemented by authorizers which can check any rights of a token on a resource; it returns ErrAccessDenied if one is missing
+type RightsChecker interface {
+	HasRights(token auth.Token, kind string, id string, rights string) error
+}
+
+// DelegatingAuthorizer lets users without administration right grant a subset of their own rights, never "a".
+// Delegates may only add rights, the rights the grantee already holds have to be kept.
+type DelegatingAuthorizer struct {
+	Authorizer
+}
+
+func (this DelegatingAuthorizer) AuthorizeCommand(token auth.Token, cmd PermCommandMsg) error {
+	err := authorize(this.Authorizer, token, cmd)
+	if !errors.Is(err, ErrAccessDenied) || !delegationApplies(cmd) {
+		return err
+	}
+	checker, ok := this.Authorizer.(RightsChecker)
+	if !ok {
+		return err
+	}
+	err = requireDefaultTopics(token)
+	if err != nil {
+		return err
+	}
+	p, err := getSyncedProjection()
+	if err != nil {
+		return err
+	}
+	resource, _ := p.Get(cmd.Kind, cmd.Resource)
+	current := resource.Users[cmd.User]
+	if cmd.User == "" {
+		current = resource.Groups[cmd.Group]
+	}
+	err = checkDelegatedRight(cmd, current)
+	if err != nil {
+		return err
+	}
+	needed := model.NormalizeRight(cmd.Right)
+	err = checker.HasRights(token, cmd.Kind, cmd.Resource, needed)
+	if errors.Is(err, ErrAccessDenied) {
+		return delegationDenied("missing rights " + needed + " to delegate on " + cmd.Kind + " " + cmd.Resource)
+	}
+	return err
+}
+
+// delegationApplies is true for PUT commands granting rights without "a" on a kind of Config.DelegationKinds;
+// a PUT with empty right removes the grantee and is never delegated
+func delegationApplies(cmd PermCommandMsg) bool {
+	right := model.NormalizeRight(cmd.Right)
+	if cmd.Command != model.CommandPut || right == "" || strings.Contains(right, "a") {
+		return false
+	}
+	return slices.Contains(Config.DelegationKinds, cmd.Kind) || slices.Contains(Config.DelegationKinds, "*")
+}
+
+// checkDelegatedRight denies delegated commands which would change the rights of administrators
+// or remove any right the grantee currently holds
+func checkDelegatedRight(cmd PermCommandMsg, current string) error {
+	if strings.Contains(current, "a") {
+		return delegationDenied("the rights of administrators of " + cmd.Kind + " " + cmd.Resource + " can not be changed by delegation")
+	}
+	right := model.NormalizeRight(cmd.Right)
+	for _, r := range current {
+		if !strings.ContainsRune(right, r) {
+			return delegationDenied("the current rights " + current + " of the grantee on " + cmd.Kind + " " + cmd.Resource + " can not be lowered by delegation")
+		}
+	}
+	return nil
+}
+
+func delegationDenied(detail string) error {
+	p := problem.New(http.StatusForbidden, problem.NotResourceAdmin, detail)
+	p.Rule = "delegation"
+	return p
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lib
+
+import (
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+func TestDelegationApplies(t *testing.T) {
+	old := Config
+	Config = &ConfigStruct{DelegationKinds: []string{"devices"}}
+	t.Cleanup(func() {
+		Config = old
+	})
+	cases := map[string]struct {
+		cmd      PermCommandMsg
+		expected bool
+	}{
+		"grant":         {PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u2", Right: "rx"}, true},
+		"admin":         {PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u2", Right: "rwxa"}, false},
+		"empty right":   {PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u2", Right: ""}, false},
+		"unknown right": {PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u2", Right: "-"}, false},
+		"delete":        {PermCommandMsg{Command: model.CommandDelete, Kind: "devices", Resource: "d1", User: "u2"}, false},
+		"other kind":    {PermCommandMsg{Command: model.CommandPut, Kind: "hubs", Resource: "h1", User: "u2", Right: "r"}, false},
+	}
+	for name, c := range cases {
+		if actual := delegationApplies(c.cmd); actual != c.expected {
+			t.Errorf("%v: expected %v, got %v", name, c.expected, actual)
+		}
+	}
+}
+
+func TestDelegatedRightsCanNotBeLowered(t *testing.T) {
+	cmd := PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u2", Right: "r"}
+	if err := checkDelegatedRight(cmd, ""); err != nil {
+		t.Error("expected new grantee to be accepted, got", err)
+	}
+	if err := checkDelegatedRight(cmd, "r"); err != nil {
+		t.Error("expected unchanged rights to be accepted, got", err)
+	}
+	cmd.Right = "rx"
+	if err := checkDelegatedRight(cmd, "r"); err != nil {
+		t.Error("expected added rights to be accepted, got", err)
+	}
+	cmd.Right = "r"
+	if err := checkDelegatedRight(cmd, "rx"); err == nil {
+		t.Error("expected lowered rights to be denied")
+	}
+	cmd.Right = "rwx"
+	if err := checkDelegatedRight(cmd, "rwxa"); err == nil {
+		t.Error("expected change of administrator to be denied")
+	}
+}
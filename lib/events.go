@@ -18,18 +18,13 @@ package lib
 
 import (
 	"log"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
 )
 
 var conn *Publisher
 
-type PermCommandMsg struct {
-	Command  string `json:"command"`
-	Kind     string
-	Resource string
-	User     string
-	Group    string
-	Right    string
-}
+type PermCommandMsg = model.PermCommandMsg
 
 func InitEventConn() {
 	var err error
@@ -40,7 +35,7 @@ func InitEventConn() {
 }
 
 func StopEventConn() {
-	conn.writer.Close()
+	conn.Close()
 }
 
 func sendEvent(command PermCommandMsg) error {
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/jobs"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+const (
+	JobTypeGroupRemoval   = "group_removal"
+	JobTypeGroupMigration = "group_migration"
+)
+
+type GroupMigration struct {
+	Target string `json:"target"`
+}
+
+// RemoveGroupEverywhere starts a job deleting every right of the group known to the permission topic
+func RemoveGroupEverywhere(token auth.Token, group string) (jobs.Job, error) {
+	t, err := getTenant(token)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	//protected groups can neither be removed from every resource nor migrated, not even by admins
+	if getPolicyOf(t).Config().IsProtectedGroup(group) {
+		return jobs.Job{}, problem.New(http.StatusForbidden, problem.AdminGroupProtected, "the protected group "+group+" can not be removed from all resources")
+	}
+	return submitJob(JobTypeGroupRemoval, t, token, func(ctx context.Context) (commands []model.Command, err error) {
+		grants, err := ReplayGrants(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range grants {
+			if grant.Group == group {
+				commands = append(commands, model.Command{Command: model.CommandDelete, Kind: grant.Kind, Resource: grant.Resource, Group: group})
+			}
+		}
+		return commands, nil
+	})
+}
+
+// MigrateGroup starts a job granting every right of source to target and removing source afterwards.
+// If target already holds a right on a resource, it receives the union of both rights.
+func MigrateGroup(token auth.Token, source string, target string) (jobs.Job, error) {
+	t, err := getTenant(token)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if getPolicyOf(t).Config().IsProtectedGroup(source) {
+		return jobs.Job{}, problem.New(http.StatusForbidden, problem.AdminGroupProtected, "the rights of the protected group "+source+" can not be migrated")
+	}
+	if target == "" || target == source {
+		return jobs.Job{}, problem.New(http.StatusBadRequest, problem.ValidationFailed, "target has to be a different group")
+	}
+	return submitJob(JobTypeGroupMigration, t, token, func(ctx context.Context) (commands []model.Command, err error) {
+		grants, err := ReplayGrants(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		targetRights := map[string]string{}
+		for _, grant := range grants {
+			if grant.Group == target {
+				targetRights[grant.Kind+"/"+grant.Resource] = grant.Right
+			}
+		}
+		removals := []model.Command{}
+		for _, grant := range grants {
+			if grant.Group != source {
+				continue
+			}
+			commands = append(commands, model.Command{
+				Command:  model.CommandPut,
+				Kind:     grant.Kind,
+				Resource: grant.Resource,
+				Group:    target,
+				Right:    model.NormalizeRight(grant.Right + targetRights[grant.Kind+"/"+grant.Resource]),
+			})
+			removals = append(removals, model.Command{Command: model.CommandDelete, Kind: grant.Kind, Resource: grant.Resource, Group: source})
+		}
+		// grant everything first, so that no resource loses access if the job fails midway
+		return append(commands, removals...), nil
+	})
+}
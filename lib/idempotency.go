@@ -0,0 +1,41 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"log"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/idempotency"
+)
+
+// getIdempotencyHandler stores responses in Config.IdempotencyStoreDir or, if empty, in memory;
+// expired records are only removed after Start
+func getIdempotencyHandler() *idempotency.Handler {
+	ttl, err := time.ParseDuration(Config.IdempotencyTtl)
+	if err != nil {
+		log.Fatal("ERROR: invalid IdempotencyTtl ", err)
+	}
+	var store idempotency.Store = idempotency.NewMemoryStore()
+	if Config.IdempotencyStoreDir != "" {
+		store, err = idempotency.NewFileStore(Config.IdempotencyStoreDir)
+		if err != nil {
+			log.Fatal("ERROR: unable to open idempotency store ", err)
+		}
+	}
+	return idempotency.New(store, ttl, Config.MaxBodySize)
+}
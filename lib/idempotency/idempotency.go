@@ -0,0 +1,190 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package idempotency replays the stored response of requests repeated with the same Idempotency-Key header.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+const Header = "Idempotency-Key"
+
+// ReplayHeader is set on replayed responses
+const ReplayHeader = "Idempotent-Replayed"
+
+// storedHeaders are the response headers replayed together with status and body
+var storedHeaders = []string{"Content-Type", "Location"}
+
+type Handler struct {
+	store       Store
+	ttl         time.Duration
+	maxBodySize int64
+	mux         sync.Mutex
+	inFlight    map[string]bool
+}
+
+// New creates a handler reading at most maxBodySize bytes of request bodies, 0 for no limit
+func New(store Store, ttl time.Duration, maxBodySize int64) *Handler {
+	return &Handler{store: store, ttl: ttl, maxBodySize: maxBodySize, inFlight: map[string]bool{}}
+}
+
+// Start removes expired records until ctx is done
+func (this *Handler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(max(this.ttl/10, time.Minute))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := this.store.DeleteExpired(time.Now())
+				if err != nil {
+					log.Println("ERROR: unable to remove expired idempotency records", err)
+				}
+			}
+		}
+	}()
+}
+
+// Wrap calls next once per key and scope; repeated requests with the same method, path and body
+// get the stored response, other requests reusing the key get 422.
+// Responses with status >= 500 are not stored, so the request can be retried.
+func (this *Handler) Wrap(scope func(r *http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next(res, r)
+			return
+		}
+		if this.maxBodySize > 0 {
+			r.Body = http.MaxBytesReader(res, r.Body, this.maxBodySize)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.WriteBodyError(res, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		storeKey := hash(scope(r), key)
+		fingerprint := hash(r.Method, r.URL.Path, r.URL.RawQuery, string(body))
+
+		if !this.lock(storeKey) {
+			problem.Write(res, r, http.StatusConflict, problem.IdempotencyKeyInUse, "a request with this "+Header+" is still in progress")
+			return
+		}
+		defer this.unlock(storeKey)
+
+		record, found, err := this.store.Get(storeKey)
+		if err != nil {
+			problem.WriteInternal(res, r, http.StatusInternalServerError, problem.Internal, err)
+			return
+		}
+		if found && time.Now().Before(record.Expires) {
+			if record.Fingerprint != fingerprint {
+				problem.Write(res, r, http.StatusUnprocessableEntity, problem.IdempotencyKeyReused, Header+" was already used for a different request")
+				return
+			}
+			for name, value := range record.Header {
+				res.Header().Set(name, value)
+			}
+			res.Header().Set(ReplayHeader, "true")
+			res.WriteHeader(record.Status)
+			res.Write(record.Body)
+			return
+		}
+
+		recorder := &recorder{ResponseWriter: res, status: http.StatusOK}
+		next(recorder, r)
+		if recorder.status >= 500 {
+			return
+		}
+		record = Record{Fingerprint: fingerprint, Status: recorder.status, Header: map[string]string{}, Body: recorder.body.Bytes(), Expires: time.Now().Add(this.ttl)}
+		for _, name := range storedHeaders {
+			if value := res.Header().Get(name); value != "" {
+				record.Header[name] = value
+			}
+		}
+		err = this.store.Save(storeKey, record)
+		if err != nil {
+			log.Println("ERROR: unable to store idempotency record", err)
+		}
+	}
+}
+
+func (this *Handler) lock(key string) bool {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.inFlight[key] {
+		return false
+	}
+	this.inFlight[key] = true
+	return true
+}
+
+func (this *Handler) unlock(key string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	delete(this.inFlight, key)
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder copies the response while writing it, streamed responses are still flushed
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (this *recorder) WriteHeader(status int) {
+	if !this.wroteHeader {
+		this.status = status
+		this.wroteHeader = true
+	}
+	this.ResponseWriter.WriteHeader(status)
+}
+
+func (this *recorder) Write(b []byte) (int, error) {
+	this.wroteHeader = true
+	this.body.Write(b)
+	return this.ResponseWriter.Write(b)
+}
+
+func (this *recorder) Flush() {
+	if flusher, ok := this.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package idempotency
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+func counting(calls *int) http.HandlerFunc {
+	return func(res http.ResponseWriter, r *http.Request) {
+		*calls++
+		body, _ := io.ReadAll(r.Body)
+		res.Header().Set("Content-Type", "text/plain")
+		res.Header().Set("Location", "/jobs/"+strconv.Itoa(*calls))
+		res.WriteHeader(http.StatusCreated)
+		res.Write(body)
+	}
+}
+
+func request(key string, path string, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	return req
+}
+
+func user(r *http.Request) string {
+	return "u1"
+}
+
+func TestReplay(t *testing.T) {
+	calls := 0
+	handler := New(NewMemoryStore(), time.Hour, 0).Wrap(user, counting(&calls))
+
+	first := httptest.NewRecorder()
+	handler(first, request("k1", "/batch", "body"))
+	second := httptest.NewRecorder()
+	handler(second, request("k1", "/batch", "body"))
+
+	if calls != 1 {
+		t.Error("expected one call, got", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != "body" || second.Header().Get("Location") != "/jobs/1" || second.Header().Get("Content-Type") != "text/plain" {
+		t.Error("unexpected replay", second.Code, second.Body.String(), second.Header())
+	}
+	if second.Header().Get(ReplayHeader) != "true" || first.Header().Get(ReplayHeader) != "" {
+		t.Error("expected only the replay to be marked")
+	}
+
+	handler(httptest.NewRecorder(), request("", "/batch", "body"))
+	handler(httptest.NewRecorder(), request("", "/batch", "body"))
+	if calls != 3 {
+		t.Error("expected requests without key to be handled every time, got", calls)
+	}
+}
+
+func TestKeyReuse(t *testing.T) {
+	calls := 0
+	handler := New(NewMemoryStore(), time.Hour, 0).Wrap(user, counting(&calls))
+	handler(httptest.NewRecorder(), request("k1", "/batch", "body"))
+
+	for name, req := range map[string]*http.Request{
+		"other body": request("k1", "/batch", "other"),
+		"other path": request("k1", "/import", "body"),
+	} {
+		res := httptest.NewRecorder()
+		handler(res, req)
+		if res.Code != http.StatusUnprocessableEntity || !strings.Contains(res.Body.String(), string(problem.IdempotencyKeyReused)) {
+			t.Errorf("%v: expected 422, got %v %v", name, res.Code, res.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Error("expected reused keys not to be handled, got", calls)
+	}
+}
+
+func TestKeysAreScoped(t *testing.T) {
+	calls := 0
+	scope := func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	}
+	handler := New(NewMemoryStore(), time.Hour, 0).Wrap(scope, counting(&calls))
+	for _, u := range []string{"u1", "u2"} {
+		req := request("k1", "/batch", "body-of-"+u)
+		req.Header.Set("X-User", u)
+		res := httptest.NewRecorder()
+		handler(res, req)
+		if res.Code != http.StatusCreated {
+			t.Error("expected keys of other users to be independent, got", res.Code, res.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Error("expected two calls, got", calls)
+	}
+}
+
+func TestServerErrorsAreNotStored(t *testing.T) {
+	calls := 0
+	handler := New(NewMemoryStore(), time.Hour, 0).Wrap(user, func(res http.ResponseWriter, r *http.Request) {
+		calls++
+		res.WriteHeader(http.StatusInternalServerError)
+	})
+	handler(httptest.NewRecorder(), request("k1", "/batch", "body"))
+	handler(httptest.NewRecorder(), request("k1", "/batch", "body"))
+	if calls != 2 {
+		t.Error("expected retry after server error to be handled, got", calls)
+	}
+}
+
+func TestExpiredRecords(t *testing.T) {
+	calls := 0
+	store := NewMemoryStore()
+	handler := New(store, time.Millisecond, 0).Wrap(user, counting(&calls))
+	handler(httptest.NewRecorder(), request("k1", "/batch", "body"))
+	time.Sleep(5 * time.Millisecond)
+
+	res := httptest.NewRecorder()
+	handler(res, request("k1", "/batch", "other"))
+	if calls != 2 || res.Code != http.StatusCreated {
+		t.Error("expected expired key to be usable again, got", calls, res.Code)
+	}
+
+	err := store.DeleteExpired(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Get(hash("u1", "k1")); found {
+		t.Error("expected expired record to be removed")
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	calls := 0
+	handler := New(NewMemoryStore(), time.Hour, 4).Wrap(user, counting(&calls))
+	res := httptest.NewRecorder()
+	handler(res, request("k1", "/batch", "too large"))
+	if res.Code != http.StatusRequestEntityTooLarge || calls != 0 {
+		t.Error("expected 413, got", res.Code, res.Body.String())
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	err = store.Save("expired", Record{Fingerprint: "f1", Expires: now.Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Save("valid", Record{Fingerprint: "f2", Status: http.StatusOK, Expires: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.DeleteExpired(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Get("expired"); found {
+		t.Error("expected expired record to be removed")
+	}
+	record, found, err := store.Get("valid")
+	if err != nil || !found || record.Fingerprint != "f2" || record.Status != http.StatusOK {
+		t.Error("unexpected record", record, found, err)
+	}
+}
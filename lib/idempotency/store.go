@@ -0,0 +1,114 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/jsonfile"
+)
+
+// Record is the stored response of a request
+type Record struct {
+	Fingerprint string            `json:"fingerprint"` //hash of method, path and body
+	Status      int               `json:"status"`
+	Header      map[string]string `json:"header"`
+	Body        []byte            `json:"body"`
+	Expires     time.Time         `json:"expires"`
+}
+
+// Store persists records by the hash of the scoped idempotency key
+type Store interface {
+	Get(key string) (record Record, found bool, err error)
+	Save(key string, record Record) error
+	DeleteExpired(now time.Time) error
+}
+
+// MemoryStore keeps records until restart
+type MemoryStore struct {
+	mux     sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]Record{}}
+}
+
+func (this *MemoryStore) Get(key string) (Record, bool, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	record, ok := this.records[key]
+	return record, ok, nil
+}
+
+func (this *MemoryStore) Save(key string, record Record) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.records[key] = record
+	return nil
+}
+
+func (this *MemoryStore) DeleteExpired(now time.Time) error {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	for key, record := range this.records {
+		if now.After(record.Expires) {
+			delete(this.records, key)
+		}
+	}
+	return nil
+}
+
+// FileStore writes one json file per record into a directory
+type FileStore struct {
+	files *jsonfile.Dir[Record]
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	files, err := jsonfile.NewDir[Record](dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{files: files}, nil
+}
+
+func (this *FileStore) Get(key string) (record Record, found bool, err error) {
+	return this.files.Get(key)
+}
+
+func (this *FileStore) Save(key string, record Record) error {
+	return this.files.Save(key, record)
+}
+
+// DeleteExpired removes expired and unreadable records
+func (this *FileStore) DeleteExpired(now time.Time) error {
+	keys, err := this.files.Ids()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		record, found, err := this.files.Get(key)
+		if err != nil || (found && now.After(record.Expires)) {
+			err = this.files.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/jobs"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/policy"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
+)
+
+var jobManager *jobs.Manager
+
+// InitJobs starts the job workers and resumes jobs persisted in Config.JobStoreDir
+func InitJobs(ctx context.Context) {
+	var store jobs.Store = jobs.MemoryStore{}
+	if Config.JobStoreDir != "" {
+		fileStore, err := jobs.NewFileStore(Config.JobStoreDir)
+		if err != nil {
+			log.Fatal("ERROR: unable to open job store ", err)
+		}
+		store = fileStore
+	}
+	retention, err := time.ParseDuration(Config.JobRetention)
+	if err != nil {
+		log.Fatal("ERROR: invalid JobRetention ", err)
+	}
+	manager := jobs.NewManager(store, publishJobItem, jobs.Config{Workers: int(Config.JobWorkers), Retention: retention})
+	err = manager.Start(ctx)
+	if err != nil {
+		log.Fatal("ERROR: unable to start jobs ", err)
+	}
+	jobManager = manager
+}
+
+// publishJobItem publishes to the topics of the tenant of the job. The policy is evaluated again, because it may have
+// changed since the job was planned; jobs are only submitted with the admin role of their tenant.
+func publishJobItem(ctx context.Context, job jobs.Job, command model.Command) error {
+	t, err := getTenantByName(job.Tenant)
+	if err != nil {
+		return err
+	}
+	msg := CommandFromModel(command)
+	err = checkPolicy(t, policy.Request{UserId: job.Owner, IsAdmin: true, Command: msg})
+	if err != nil {
+		return err
+	}
+	return conn.PublishTo(ctx, t.TopicOf(TopicOfKind(command.Kind)), msg)
+}
+
+func getJobManager() (*jobs.Manager, error) {
+	if jobManager == nil {
+		return nil, problem.New(http.StatusServiceUnavailable, problem.Internal, "jobs are not available")
+	}
+	return jobManager, nil
+}
+
+func submitJob(jobType string, t tenant.Tenant, token auth.Token, plan jobs.Plan) (jobs.Job, error) {
+	manager, err := getJobManager()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	job, err := manager.Submit(jobType, t.Name, token.GetUserId(), parkPlanIfRequired(t, token, checkPlan(token, plan)))
+	if err != nil {
+		return job, problem.Wrap(http.StatusServiceUnavailable, problem.Internal, err)
+	}
+	return job, nil
+}
+
+// checkPlan fails the job if one of the planned commands violates the policy of the tenant, before anything is published
+func checkPlan(token auth.Token, plan jobs.Plan) jobs.Plan {
+	return func(ctx context.Context) ([]model.Command, error) {
+		commands, err := plan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i, command := range commands {
+			err = CheckCommand(token, CommandFromModel(command))
+			if err != nil {
+				return nil, withIndex(err, i)
+			}
+		}
+		return commands, nil
+	}
+}
+
+// sendJob responds with 202 and the job, pointing to its status resource
+func sendJob(res http.ResponseWriter, job jobs.Job) {
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Location", "/jobs/"+job.Id)
+	res.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(res).Encode(job)
+}
+
+// getVisibleJob returns a job to its owner and to tokens with the admin role of its tenant
+func getVisibleJob(r *http.Request, id string) (jobs.Job, error) {
+	token, err := auth.GetParsedToken(r)
+	if err != nil {
+		return jobs.Job{}, problem.New(http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
+	}
+	t, err := getTenant(token)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	manager, err := getJobManager()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	job, err := manager.Get(id)
+	if err != nil || job.Tenant != t.Name || (job.Owner != token.GetUserId() && !isAdmin(token)) {
+		return jobs.Job{}, problem.New(http.StatusNotFound, problem.NotFound, "unknown job "+id)
+	}
+	return job, nil
+}
+
+func handleGetJob(res http.ResponseWriter, r *http.Request, id string) {
+	job, err := getVisibleJob(r, id)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(job)
+}
+
+func handleListJobs(res http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetParsedToken(r)
+	if err != nil {
+		problem.Write(res, r, http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
+		return
+	}
+	t, err := getTenant(token)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	manager, err := getJobManager()
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	owner := token.GetUserId()
+	if isAdmin(token) {
+		owner = ""
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(manager.List(t.Name, owner))
+}
+
+// handleJobAction cancels or retries a job, depending on action; requeued jobs are answered with 202
+func handleJobAction(res http.ResponseWriter, r *http.Request, id string, action func(manager *jobs.Manager, id string) (jobs.Job, error), requeues bool) {
+	_, err := getVisibleJob(r, id)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	job, err := action(jobManager, id)
+	if errors.Is(err, jobs.ErrFinished) || errors.Is(err, jobs.ErrNotFinished) || errors.Is(err, jobs.ErrNothingToRetry) {
+		problem.Write(res, r, http.StatusConflict, problem.JobStateConflict, err.Error())
+		return
+	}
+	if err != nil {
+		problem.WriteError(res, r, problem.Wrap(http.StatusServiceUnavailable, problem.Internal, err))
+		return
+	}
+	if requeues {
+		sendJob(res, job)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(job)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package jobs runs long-running permission operations in the background and tracks their progress
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusRunning  = "running"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+	StatusCanceled = "canceled"
+	StatusParked   = "parked" //the commands wait for approval as Job.Change instead of being published by the job
+)
+
+var ErrNotFound = errors.New("job not found")
+var ErrFinished = errors.New("job is already finished")
+var ErrNotFinished = errors.New("job is not finished")
+var ErrNothingToRetry = errors.New("job has no failed or unprocessed items")
+
+type Job struct {
+	Id        string     `json:"id"`
+	Type      string     `json:"type"`
+	Owner     string     `json:"owner"`
+	Tenant    string     `json:"tenant,omitempty"` //tenant of the owner, whose topics the commands are published to
+	Change    string     `json:"change,omitempty"` //approval change holding the commands of a parked job
+	Status    string     `json:"status"`
+	Created   time.Time  `json:"created"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Total     int        `json:"total"`
+	Processed int        `json:"processed"`
+	Failed    int        `json:"failed"`
+	Error     string     `json:"error,omitempty"`
+	Planned   bool       `json:"planned"`
+	Items     []Item     `json:"items,omitempty"`
+
+	run int //incremented by every run, so that a run replaced after Cancel and Retry stops
+}
+
+// Item is a single command of a job and the result of its publication
+type Item struct {
+	Command     model.Command `json:"command"`
+	Done        bool          `json:"done"`
+	Attempts    int           `json:"attempts"`
+	PublishedAt *time.Time    `json:"published_at,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Plan returns the commands of a job; it is called by a worker so it may take a while.
+// Plans are not persisted: jobs interrupted by a restart before their plan finished are marked as failed.
+type Plan func(ctx context.Context) ([]model.Command, error)
+
+// Parked is returned by plans which handed their commands over to an approval change
+type Parked struct {
+	Change string
+}
+
+func (this Parked) Error() string {
+	return "the commands wait for approval of change " + this.Change
+}
+
+// Process executes a single command of the job, usually by publishing it
+type Process func(ctx context.Context, job Job, command model.Command) error
+
+func (this *Job) IsFinished() bool {
+	return this.Status == StatusDone || this.Status == StatusFailed || this.Status == StatusCanceled || this.Status == StatusParked
+}
+
+func (this *Job) copy(withItems bool) Job {
+	result := *this
+	result.Items = nil
+	if withItems {
+		result.Items = append([]Item{}, this.Items...)
+	}
+	return result
+}
+
+// count recalculates the progress counters from the items
+func (this *Job) count() {
+	this.Total = len(this.Items)
+	this.Processed = 0
+	this.Failed = 0
+	for _, item := range this.Items {
+		if item.Done {
+			this.Processed++
+		} else if item.Error != "" {
+			this.Processed++
+			this.Failed++
+		}
+	}
+}
+
+func newId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
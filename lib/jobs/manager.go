@@ -0,0 +1,366 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// saveInterval limits how often the records of running jobs are persisted
+const saveInterval = time.Second
+
+type Config struct {
+	Workers   int           //number of jobs running concurrently
+	Retention time.Duration //finished jobs are removed after this duration, 0 keeps them
+}
+
+// Manager queues jobs and runs them with a fixed number of workers.
+// The items of a job are processed in order, so plans may rely on the order of their commands.
+type Manager struct {
+	mux     sync.Mutex
+	jobs    map[string]*Job
+	plans   map[string]Plan
+	cancels map[string]context.CancelFunc
+	queue   chan string
+	store   Store
+	process Process
+	config  Config
+}
+
+func NewManager(store Store, process Process, config Config) *Manager {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	return &Manager{
+		jobs:    map[string]*Job{},
+		plans:   map[string]Plan{},
+		cancels: map[string]context.CancelFunc{},
+		queue:   make(chan string, 10000),
+		store:   store,
+		process: process,
+		config:  config,
+	}
+}
+
+// Start loads persisted jobs, requeues unfinished ones and starts the workers
+func (this *Manager) Start(ctx context.Context) error {
+	stored, err := this.store.List()
+	if err != nil {
+		return err
+	}
+	this.mux.Lock()
+	resume := []string{}
+	for _, job := range stored {
+		job := job
+		this.jobs[job.Id] = &job
+		if job.IsFinished() {
+			continue
+		}
+		if !job.Planned {
+			this.finish(&job, StatusFailed, errors.New("interrupted by restart before the job was planned"))
+			continue
+		}
+		job.Status = StatusPending
+		resume = append(resume, job.Id)
+	}
+	this.mux.Unlock()
+	for i := 0; i < this.config.Workers; i++ {
+		go this.work(ctx)
+	}
+	// more resumed jobs than the queue holds must not block the start
+	go func() {
+		for _, id := range resume {
+			log.Println("resume job", id)
+			select {
+			case this.queue <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	if this.config.Retention > 0 {
+		go this.cleanup(ctx)
+	}
+	return nil
+}
+
+// Submit queues a new job
+func (this *Manager) Submit(jobType string, tenant string, owner string, plan Plan) (Job, error) {
+	id, err := newId()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{Id: id, Type: jobType, Owner: owner, Tenant: tenant, Status: StatusPending, Created: time.Now()}
+	this.mux.Lock()
+	this.jobs[id] = job
+	this.plans[id] = plan
+	this.save(job)
+	result := job.copy(false)
+	this.mux.Unlock()
+	return result, this.enqueue(job)
+}
+
+func (this *Manager) Get(id string) (Job, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	job, ok := this.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job.copy(true), nil
+}
+
+// List returns the jobs of the tenant and owner (all jobs of the tenant if owner is empty) without items, newest first
+func (this *Manager) List(tenant string, owner string) (result []Job) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	result = []Job{}
+	for _, job := range this.jobs {
+		if job.Tenant == tenant && (owner == "" || job.Owner == owner) {
+			result = append(result, job.copy(false))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Created.After(result[j].Created)
+	})
+	return result
+}
+
+// Cancel stops a pending or running job after the item currently processed
+func (this *Manager) Cancel(id string) (Job, error) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	job, ok := this.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if job.IsFinished() {
+		return job.copy(false), ErrFinished
+	}
+	if cancel, ok := this.cancels[id]; ok {
+		cancel()
+	}
+	this.finish(job, StatusCanceled, nil)
+	return job.copy(false), nil
+}
+
+// Retry requeues a finished job; items which failed or were not processed are processed again
+func (this *Manager) Retry(id string) (Job, error) {
+	this.mux.Lock()
+	job, ok := this.jobs[id]
+	if !ok {
+		this.mux.Unlock()
+		return Job{}, ErrNotFound
+	}
+	if !job.IsFinished() {
+		this.mux.Unlock()
+		return job.copy(false), ErrNotFinished
+	}
+	if !job.Planned || job.Processed-job.Failed == job.Total {
+		this.mux.Unlock()
+		return job.copy(false), ErrNothingToRetry
+	}
+	for i := range job.Items {
+		job.Items[i].Error = ""
+	}
+	job.count()
+	job.Status = StatusPending
+	job.Error = ""
+	job.Finished = nil
+	this.save(job)
+	result := job.copy(false)
+	this.mux.Unlock()
+	return result, this.enqueue(job)
+}
+
+func (this *Manager) enqueue(job *Job) error {
+	select {
+	case this.queue <- job.Id:
+		return nil
+	default:
+		err := errors.New("job queue is full")
+		this.mux.Lock()
+		this.finish(job, StatusFailed, err)
+		this.mux.Unlock()
+		return err
+	}
+}
+
+func (this *Manager) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-this.queue:
+			this.run(ctx, id)
+		}
+	}
+}
+
+func (this *Manager) run(ctx context.Context, id string) {
+	this.mux.Lock()
+	job, ok := this.jobs[id]
+	if !ok || job.Status != StatusPending {
+		this.mux.Unlock()
+		return
+	}
+	job.run++
+	run := job.run
+	// active has to be called with the lock held; a canceled run may still be processing when Retry starts the next one
+	active := func() bool {
+		return job.run == run && job.Status == StatusRunning
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	this.cancels[id] = cancel
+	defer func() {
+		this.mux.Lock()
+		if job.run == run {
+			delete(this.cancels, id)
+			delete(this.plans, id)
+		}
+		this.mux.Unlock()
+	}()
+	now := time.Now()
+	job.Status = StatusRunning
+	job.Started = &now
+	plan := this.plans[id]
+	this.save(job)
+	this.mux.Unlock()
+
+	if !job.Planned {
+		commands, err := plan(ctx)
+		this.mux.Lock()
+		if !active() {
+			this.mux.Unlock()
+			return
+		}
+		var parked Parked
+		if errors.As(err, &parked) {
+			job.Change = parked.Change
+			this.finish(job, StatusParked, nil)
+			this.mux.Unlock()
+			return
+		}
+		if err != nil {
+			this.finish(job, StatusFailed, err)
+			this.mux.Unlock()
+			return
+		}
+		job.Items = make([]Item, len(commands))
+		for i, command := range commands {
+			job.Items[i] = Item{Command: command}
+		}
+		job.Planned = true
+		job.count()
+		this.save(job)
+		this.mux.Unlock()
+	}
+
+	lastSave := time.Now()
+	for i := range job.Items {
+		this.mux.Lock()
+		if !active() {
+			this.mux.Unlock()
+			return
+		}
+		item := job.Items[i]
+		info := job.copy(false)
+		this.mux.Unlock()
+		if item.Done {
+			continue
+		}
+		err := this.process(ctx, info, item.Command)
+
+		this.mux.Lock()
+		if !active() {
+			this.mux.Unlock()
+			return
+		}
+		job.Items[i].Attempts++
+		if err != nil {
+			job.Items[i].Error = err.Error()
+		} else {
+			now := time.Now()
+			job.Items[i].Done = true
+			job.Items[i].PublishedAt = &now
+		}
+		job.count()
+		if time.Since(lastSave) > saveInterval {
+			this.save(job)
+			lastSave = time.Now()
+		}
+		this.mux.Unlock()
+	}
+
+	this.mux.Lock()
+	if active() {
+		if job.Failed > 0 {
+			this.finish(job, StatusFailed, nil)
+		} else {
+			this.finish(job, StatusDone, nil)
+		}
+	}
+	this.mux.Unlock()
+}
+
+// finish has to be called with the lock held
+func (this *Manager) finish(job *Job, status string, err error) {
+	now := time.Now()
+	job.Finished = &now
+	job.Status = status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	this.save(job)
+}
+
+// save has to be called with the lock held
+func (this *Manager) save(job *Job) {
+	err := this.store.Save(job.copy(true))
+	if err != nil {
+		log.Println("ERROR: unable to persist job", job.Id, err)
+	}
+}
+
+func (this *Manager) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			this.mux.Lock()
+			for id, job := range this.jobs {
+				if job.IsFinished() && job.Finished != nil && time.Since(*job.Finished) > this.config.Retention {
+					delete(this.jobs, id)
+					err := this.store.Delete(id)
+					if err != nil {
+						log.Println("ERROR: unable to delete job", id, err)
+					}
+				}
+			}
+			this.mux.Unlock()
+		}
+	}
+}
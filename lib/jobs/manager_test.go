@@ -0,0 +1,169 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jobs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+func waitFinished(t *testing.T, manager *Manager, id string) Job {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		job, err := manager.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.IsFinished() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job did not finish")
+	return Job{}
+}
+
+func TestParkedPlan(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := NewManager(MemoryStore{}, func(ctx context.Context, job Job, command model.Command) error {
+		t.Error("commands of parked jobs must not be processed")
+		return nil
+	}, Config{})
+	err := manager.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := manager.Submit("test", "", "owner", func(ctx context.Context) ([]model.Command, error) {
+		return nil, Parked{Change: "c1"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitFinished(t, manager, job.Id)
+	if job.Status != StatusParked || job.Change != "c1" || job.Error != "" {
+		t.Errorf("expected parked job, got %+v", job)
+	}
+	_, err = manager.Retry(job.Id)
+	if err != ErrNothingToRetry {
+		t.Error("expected parked jobs not to be retried, got", err)
+	}
+}
+
+type storedJobs []Job
+
+func (this storedJobs) Save(job Job) error {
+	return nil
+}
+
+func (this storedJobs) Delete(id string) error {
+	return nil
+}
+
+func (this storedJobs) List() ([]Job, error) {
+	return this, nil
+}
+
+func TestResumeMoreJobsThanQueued(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stored := storedJobs{}
+	for _, id := range []string{"j1", "j2", "j3"} {
+		stored = append(stored, Job{Id: id, Status: StatusRunning, Planned: true, Items: []Item{{Command: model.Command{Command: model.CommandPut, Kind: "devices", Resource: id, User: "u1", Right: "r"}}}})
+	}
+	manager := NewManager(stored, func(ctx context.Context, job Job, command model.Command) error {
+		return nil
+	}, Config{})
+	manager.queue = make(chan string, 1)
+	started := make(chan error)
+	go func() {
+		started <- manager.Start(ctx)
+	}()
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("start blocked on the queue")
+	}
+	for _, job := range stored {
+		job = waitFinished(t, manager, job.Id)
+		if job.Status != StatusDone {
+			t.Errorf("expected resumed job to be done, got %+v", job)
+		}
+	}
+}
+
+func TestCanceledRunStopsAfterRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the first call of each resource waits until it is released
+	entered := map[string]chan struct{}{"d0": make(chan struct{}), "d1": make(chan struct{})}
+	release := map[string]chan struct{}{"d0": make(chan struct{}), "d1": make(chan struct{})}
+	var mux sync.Mutex
+	calls := map[string]int{}
+	manager := NewManager(MemoryStore{}, func(ctx context.Context, job Job, command model.Command) error {
+		mux.Lock()
+		calls[command.Resource]++
+		first := calls[command.Resource] == 1
+		mux.Unlock()
+		if first {
+			close(entered[command.Resource])
+			<-release[command.Resource]
+		}
+		return nil
+	}, Config{Workers: 2})
+	err := manager.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := manager.Submit("test", "", "owner", func(ctx context.Context) ([]model.Command, error) {
+		return []model.Command{
+			{Command: model.CommandDelete, Kind: "devices", Resource: "d0", User: "u1"},
+			{Command: model.CommandDelete, Kind: "devices", Resource: "d1", User: "u1"},
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-entered["d0"]
+	_, err = manager.Cancel(job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = manager.Retry(job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the second run processes d1 while the canceled first run returns from d0
+	<-entered["d1"]
+	close(release["d0"])
+	time.Sleep(50 * time.Millisecond)
+	close(release["d1"])
+	job = waitFinished(t, manager, job.Id)
+
+	mux.Lock()
+	defer mux.Unlock()
+	if job.Status != StatusDone || calls["d1"] != 1 {
+		t.Errorf("expected the canceled run to stop, got %v with calls %v", job.Status, calls)
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jobs
+
+import "github.com/SENERGY-Platform/permission-command/lib/jsonfile"
+
+// Store persists job records
+type Store interface {
+	Save(job Job) error
+	Delete(id string) error
+	List() ([]Job, error)
+}
+
+// MemoryStore keeps nothing; jobs are lost on restart
+type MemoryStore struct{}
+
+func (this MemoryStore) Save(job Job) error {
+	return nil
+}
+
+func (this MemoryStore) Delete(id string) error {
+	return nil
+}
+
+func (this MemoryStore) List() ([]Job, error) {
+	return nil, nil
+}
+
+// FileStore writes one json file per job into a directory
+type FileStore struct {
+	files *jsonfile.Dir[Job]
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	files, err := jsonfile.NewDir[Job](dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{files: files}, nil
+}
+
+func (this *FileStore) Save(job Job) error {
+	return this.files.Save(job.Id, job)
+}
+
+func (this *FileStore) Delete(id string) error {
+	return this.files.Delete(id)
+}
+
+func (this *FileStore) List() ([]Job, error) {
+	return this.files.List()
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/jobs"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/policy"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+func setupPolicy(t *testing.T, config policy.Config) {
+	err := LoadConfig("../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	usePolicy(t, config)
+}
+
+// usePolicy replaces the policy of the loaded configuration
+func usePolicy(t *testing.T, config policy.Config) {
+	Config.Policy = &config
+	policyOnce = sync.Once{}
+	t.Cleanup(func() {
+		policyOnce = sync.Once{}
+	})
+}
+
+func TestPlannedCommandsFollowPolicy(t *testing.T) {
+	setupPolicy(t, policy.Config{DeniedGroups: []string{"denied"}})
+	token := testToken(t, "admin", "admin")
+	plan := checkPlan(token, func(ctx context.Context) ([]model.Command, error) {
+		return []model.Command{
+			{Command: model.CommandPut, Kind: "devices", Resource: "d1", Group: "denied", Right: "rx"},
+			{Command: model.CommandDelete, Kind: "devices", Resource: "d1", Group: "source"},
+		}, nil
+	})
+	commands, err := plan(context.Background())
+	var p problem.Problem
+	if !errors.As(err, &p) || p.Rule != "denied-principal" || commands != nil {
+		t.Fatalf("expected plan to fail with the policy violation, got %v %v", commands, err)
+	}
+
+	plan = checkPlan(token, func(ctx context.Context) ([]model.Command, error) {
+		return []model.Command{{Command: model.CommandPut, Kind: "devices", Resource: "d1", Group: "target", Right: "rx"}}, nil
+	})
+	commands, err = plan(context.Background())
+	if err != nil || len(commands) != 1 {
+		t.Fatalf("expected valid plan, got %v %v", commands, err)
+	}
+}
+
+func TestJobItemsAreCheckedBeforePublishing(t *testing.T) {
+	setupPolicy(t, policy.Config{Kinds: map[string]policy.KindPolicy{"devices": {Rights: "rx"}}})
+	err := publishJobItem(context.Background(), jobs.Job{Owner: "admin"}, model.Command{Command: model.CommandPut, Kind: "devices", Resource: "d1", Group: "target", Right: "rwx"})
+	var p problem.Problem
+	if !errors.As(err, &p) || p.Rule != "valid-rights" {
+		t.Fatal("expected policy violation, got", err)
+	}
+}
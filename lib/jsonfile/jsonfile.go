@@ -0,0 +1,123 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package jsonfile writes json files atomically and stores values as one json file per id in a directory
+package jsonfile
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const extension = ".json"
+
+// Write encodes value into a temporary file next to location and renames it, so that readers never see partial files
+func Write(location string, value interface{}) error {
+	temp, err := os.CreateTemp(filepath.Dir(location), filepath.Base(location)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	err = json.NewEncoder(temp).Encode(value)
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	err = temp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), location)
+}
+
+// Dir stores values of type T as one json file per id
+type Dir[T any] struct {
+	dir string
+}
+
+// NewDir creates dir if it does not exist
+func NewDir[T any](dir string) (*Dir[T], error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &Dir[T]{dir: dir}, nil
+}
+
+func (this *Dir[T]) location(id string) string {
+	return filepath.Join(this.dir, id+extension)
+}
+
+func (this *Dir[T]) Save(id string, value T) error {
+	return Write(this.location(id), value)
+}
+
+// Get returns false if no value is stored for id
+func (this *Dir[T]) Get(id string) (value T, found bool, err error) {
+	content, err := os.ReadFile(this.location(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, err
+	}
+	err = json.Unmarshal(content, &value)
+	return value, err == nil, err
+}
+
+// Delete ignores ids without stored value
+func (this *Dir[T]) Delete(id string) error {
+	err := os.Remove(this.location(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Ids returns the ids of all stored values
+func (this *Dir[T]) Ids() (result []string, err error) {
+	entries, err := os.ReadDir(this.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), extension) {
+			result = append(result, strings.TrimSuffix(entry.Name(), extension))
+		}
+	}
+	return result, nil
+}
+
+// List returns all stored values; it fails if one of them can not be decoded
+func (this *Dir[T]) List() (result []T, err error) {
+	ids, err := this.Ids()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		value, found, err := this.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			result = append(result, value)
+		}
+	}
+	return result, nil
+}
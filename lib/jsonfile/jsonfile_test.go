@@ -0,0 +1,93 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package jsonfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type value struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestDir(t *testing.T) {
+	dir, err := NewDir[value](filepath.Join(t.TempDir(), "values"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Save("a", value{Id: "a", Name: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Save("a", value{Id: "a", Name: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Save("b", value{Id: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//left over by an interrupted Write
+	err = os.WriteFile(filepath.Join(dir.dir, "c.json.123.tmp"), []byte("{"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, found, err := dir.Get("a")
+	if err != nil || !found || a.Name != "second" {
+		t.Errorf("unexpected value %+v %v %v", a, found, err)
+	}
+	list, err := dir.List()
+	if err != nil || len(list) != 2 {
+		t.Errorf("unexpected list %+v %v", list, err)
+	}
+
+	err = dir.Delete("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dir.Delete("a")
+	if err != nil {
+		t.Error("expected deleting missing values to succeed, got", err)
+	}
+	_, found, err = dir.Get("a")
+	if err != nil || found {
+		t.Errorf("expected deleted value to be missing, got %v %v", found, err)
+	}
+}
+
+func TestWriteReplacesFile(t *testing.T) {
+	location := filepath.Join(t.TempDir(), "snapshot.json")
+	err := Write(location, value{Name: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Write(location, value{Name: "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(location)
+	if err != nil || string(content) != `{"id":"","name":"second"}`+"\n" {
+		t.Errorf("unexpected content %q %v", content, err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(location))
+	if len(entries) != 1 {
+		t.Error("expected no temporary files, got", entries)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kafkaauth builds the TLS and SASL settings used by every kafka connection of the service.
+package kafkaauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	MechanismPlain       = "PLAIN"
+	MechanismScramSha256 = "SCRAM-SHA-256"
+	MechanismScramSha512 = "SCRAM-SHA-512"
+)
+
+type Config struct {
+	TlsEnabled            bool
+	TlsCaFile             string //pem file; empty uses the system pool
+	TlsCertFile           string //pem client certificate for mutual tls
+	TlsKeyFile            string
+	TlsInsecureSkipVerify bool //only for development
+
+	SaslMechanism string //empty | PLAIN | SCRAM-SHA-256 | SCRAM-SHA-512
+	SaslUsername  string
+	SaslPassword  string
+}
+
+// TLS returns nil if tls is disabled
+func (this Config) TLS() (*tls.Config, error) {
+	if !this.TlsEnabled {
+		return nil, nil
+	}
+	result := &tls.Config{InsecureSkipVerify: this.TlsInsecureSkipVerify}
+	if this.TlsCaFile != "" {
+		pem, err := os.ReadFile(this.TlsCaFile)
+		if err != nil {
+			return nil, err
+		}
+		result.RootCAs = x509.NewCertPool()
+		if !result.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in kafka tls ca file " + this.TlsCaFile)
+		}
+	}
+	if this.TlsCertFile != "" || this.TlsKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(this.TlsCertFile, this.TlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		result.Certificates = []tls.Certificate{cert}
+	}
+	return result, nil
+}
+
+// Mechanism returns nil if sasl is disabled
+func (this Config) Mechanism() (sasl.Mechanism, error) {
+	switch strings.ToUpper(this.SaslMechanism) {
+	case "":
+		return nil, nil
+	case MechanismPlain:
+		return plain.Mechanism{Username: this.SaslUsername, Password: this.SaslPassword}, nil
+	case MechanismScramSha256:
+		return scram.Mechanism(scram.SHA256, this.SaslUsername, this.SaslPassword)
+	case MechanismScramSha512:
+		return scram.Mechanism(scram.SHA512, this.SaslUsername, this.SaslPassword)
+	default:
+		return nil, errors.New("unknown kafka sasl mechanism " + this.SaslMechanism)
+	}
+}
+
+// Dialer is used for broker discovery, topic creation and consumers
+func (this Config) Dialer() (*kafka.Dialer, error) {
+	tlsConfig, err := this.TLS()
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := this.Mechanism()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// Transport is used by writers
+func (this Config) Transport() (*kafka.Transport, error) {
+	tlsConfig, err := this.TLS()
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := this.Mechanism()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Transport{
+		DialTimeout: 10 * time.Second,
+		TLS:         tlsConfig,
+		SASL:        mechanism,
+	}, nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest lists the desired rights of resources.
+// With Prune, rights of the listed resources which are not declared are removed.
+type Manifest struct {
+	Prune     bool       `json:"prune" yaml:"prune"`
+	Resources []Resource `json:"resources" yaml:"resources"`
+}
+
+type Resource struct {
+	Kind     string            `json:"kind" yaml:"kind"`
+	Resource string            `json:"resource" yaml:"resource"`
+	Users    map[string]string `json:"users,omitempty" yaml:"users,omitempty"`
+	Groups   map[string]string `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// Current returns the current user and group rights of a resource
+type Current func(kind string, resource string) (users map[string]string, groups map[string]string)
+
+// Expand replaces a role name by its right string; right strings are returned unchanged
+type Expand func(kind string, right string) (string, error)
+
+// Parse reads json or, if isYaml is set, yaml manifests. If expand is not nil, role names are replaced before validation.
+func Parse(data []byte, isYaml bool, expand Expand) (result Manifest, err error) {
+	if isYaml {
+		err = yaml.Unmarshal(data, &result)
+	} else {
+		err = json.Unmarshal(data, &result)
+	}
+	if err != nil {
+		return result, err
+	}
+	if expand != nil {
+		err = result.expand(expand)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, result.Validate()
+}
+
+func (this Manifest) expand(expand Expand) (err error) {
+	for i, resource := range this.Resources {
+		for _, rights := range []map[string]string{resource.Users, resource.Groups} {
+			for name, right := range rights {
+				rights[name], err = expand(resource.Kind, right)
+				if err != nil {
+					return fmt.Errorf("resources[%v].%v: %w", i, name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// IsYaml decides by content type or file name if a manifest is yaml encoded
+func IsYaml(contentTypeOrFileName string) bool {
+	s := strings.ToLower(contentTypeOrFileName)
+	return strings.Contains(s, "yaml") || strings.HasSuffix(s, ".yml")
+}
+
+func (this Manifest) Validate() error {
+	seen := map[string]bool{}
+	for i, resource := range this.Resources {
+		if resource.Kind == "" || resource.Resource == "" {
+			return fmt.Errorf("resources[%v]: kind and resource are required", i)
+		}
+		key := resource.Kind + "/" + resource.Resource
+		if seen[key] {
+			return fmt.Errorf("resources[%v]: %v is declared more than once", i, key)
+		}
+		seen[key] = true
+		for name, right := range resource.Users {
+			if name == "" || right == "" || strings.Trim(right, "rwxa") != "" {
+				return fmt.Errorf("resources[%v].users.%v: invalid right %q", i, name, right)
+			}
+		}
+		for name, right := range resource.Groups {
+			if name == "" || right == "" || strings.Trim(right, "rwxa") != "" {
+				return fmt.Errorf("resources[%v].groups.%v: invalid right %q", i, name, right)
+			}
+		}
+	}
+	if len(this.Resources) == 0 {
+		return errors.New("manifest contains no resources")
+	}
+	return nil
+}
+
+// Diff returns the commands needed to change the current state to the state declared in the manifest
+func (this Manifest) Diff(current Current) (commands []model.Command) {
+	for _, resource := range this.Resources {
+		users, groups := current(resource.Kind, resource.Resource)
+		commands = append(commands, diff(resource, resource.Users, users, this.Prune, func(cmd *model.Command, name string) { cmd.User = name })...)
+		commands = append(commands, diff(resource, resource.Groups, groups, this.Prune, func(cmd *model.Command, name string) { cmd.Group = name })...)
+	}
+	return commands
+}
+
+func diff(resource Resource, desired map[string]string, current map[string]string, prune bool, setPrincipal func(cmd *model.Command, name string)) (commands []model.Command) {
+	for _, name := range sortedKeys(desired) {
+		right := model.NormalizeRight(desired[name])
+		if model.NormalizeRight(current[name]) == right {
+			continue
+		}
+		cmd := model.Command{Command: model.CommandPut, Kind: resource.Kind, Resource: resource.Resource, Right: right}
+		setPrincipal(&cmd, name)
+		commands = append(commands, cmd)
+	}
+	if !prune {
+		return commands
+	}
+	for _, name := range sortedKeys(current) {
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		cmd := model.Command{Command: model.CommandDelete, Kind: resource.Kind, Resource: resource.Resource}
+		setPrincipal(&cmd, name)
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+func sortedKeys(m map[string]string) (result []string) {
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package message
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+const CloudEventsSpecVersion = "1.0"
+
+// CloudEventType returns permission.user.set, permission.group.delete, ... for the command
+func CloudEventType(cmd model.PermCommandMsg) string {
+	principal := "group"
+	if cmd.User != "" {
+		principal = "user"
+	}
+	action := "set"
+	if cmd.Command == model.CommandDelete {
+		action = "delete"
+	}
+	return "permission." + principal + "." + action
+}
+
+// CloudEventHeaders returns the kafka headers of the cloudevents 1.0 binary content mode.
+// The message value stays the encoded command and datacontenttype is the content-type header returned by Encode,
+// so consumers ignoring the headers are not affected.
+func CloudEventHeaders(cmd model.PermCommandMsg, source string, now time.Time) (map[string]string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"ce_specversion": CloudEventsSpecVersion,
+		"ce_id":          hex.EncodeToString(id),
+		"ce_source":      source,
+		"ce_type":        CloudEventType(cmd),
+		"ce_subject":     cmd.Kind + "/" + cmd.Resource,
+		"ce_time":        now.UTC().Format(time.RFC3339Nano),
+	}, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package message defines the versioned encodings of permission commands published to kafka.
+// The schemas are permission_command.schema.json (json) and permission_command.proto (protobuf).
+package message
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// SchemaVersion is written to every message; messages without version are version 1.
+// Versions only add optional fields, consumers decode messages of newer versions by ignoring unknown fields.
+const SchemaVersion = 1
+
+const (
+	EncodingJson     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+const (
+	HeaderSchemaVersion = "schema-version"
+	HeaderContentType   = "content-type"
+)
+
+const (
+	ContentTypeJson     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// ContentType returns the content-type header value of the encoding
+func ContentType(encoding string) (string, error) {
+	switch encoding {
+	case EncodingJson, "":
+		return ContentTypeJson, nil
+	case EncodingProtobuf:
+		return ContentTypeProtobuf, nil
+	default:
+		return "", errors.New("unknown message encoding " + encoding)
+	}
+}
+
+// Encode sets the schema version of cmd and encodes it; headers are the kafka headers to send with the value
+func Encode(cmd model.PermCommandMsg, encoding string) (value []byte, headers map[string]string, err error) {
+	contentType, err := ContentType(encoding)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.Version = SchemaVersion
+	headers = map[string]string{HeaderSchemaVersion: strconv.Itoa(SchemaVersion), HeaderContentType: contentType}
+	if contentType == ContentTypeProtobuf {
+		return encodeProtobuf(cmd), headers, nil
+	}
+	value, err = json.Marshal(cmd)
+	return value, headers, err
+}
+
+// Decode decodes a message by its content-type header; messages without header are json
+func Decode(value []byte, contentType string) (result model.PermCommandMsg, err error) {
+	switch contentType {
+	case ContentTypeJson, "":
+		err = json.Unmarshal(value, &result)
+	case ContentTypeProtobuf:
+		result, err = decodeProtobuf(value)
+	default:
+		return result, errors.New("unknown message content-type " + contentType)
+	}
+	if err != nil {
+		return result, err
+	}
+	if result.Version == 0 {
+		result.Version = 1
+	}
+	return result, nil
+}
+
+// protobuf field numbers of permission_command.proto
+const (
+	fieldCommand protowire.Number = iota + 1
+	fieldKind
+	fieldResource
+	fieldUser
+	fieldGroup
+	fieldRight
+	fieldVersion
+)
+
+func encodeProtobuf(cmd model.PermCommandMsg) (result []byte) {
+	for _, field := range []struct {
+		number protowire.Number
+		value  string
+	}{
+		{fieldCommand, cmd.Command},
+		{fieldKind, cmd.Kind},
+		{fieldResource, cmd.Resource},
+		{fieldUser, cmd.User},
+		{fieldGroup, cmd.Group},
+		{fieldRight, cmd.Right},
+	} {
+		//proto3 omits default values
+		if field.value != "" {
+			result = protowire.AppendTag(result, field.number, protowire.BytesType)
+			result = protowire.AppendString(result, field.value)
+		}
+	}
+	if cmd.Version != 0 {
+		result = protowire.AppendTag(result, fieldVersion, protowire.VarintType)
+		result = protowire.AppendVarint(result, uint64(cmd.Version))
+	}
+	return result
+}
+
+// decodeProtobuf skips unknown fields, so fields added by later versions do not break decoding
+func decodeProtobuf(value []byte) (result model.PermCommandMsg, err error) {
+	strings := map[protowire.Number]*string{
+		fieldCommand:  &result.Command,
+		fieldKind:     &result.Kind,
+		fieldResource: &result.Resource,
+		fieldUser:     &result.User,
+		fieldGroup:    &result.Group,
+		fieldRight:    &result.Right,
+	}
+	for len(value) > 0 {
+		number, wireType, n := protowire.ConsumeTag(value)
+		if n < 0 {
+			return result, protowire.ParseError(n)
+		}
+		value = value[n:]
+		if target, ok := strings[number]; ok && wireType == protowire.BytesType {
+			*target, n = protowire.ConsumeString(value)
+		} else if number == fieldVersion && wireType == protowire.VarintType {
+			var version uint64
+			version, n = protowire.ConsumeVarint(value)
+			result.Version = int(version)
+		} else {
+			n = protowire.ConsumeFieldValue(number, wireType, value)
+		}
+		if n < 0 {
+			return result, protowire.ParseError(n)
+		}
+		value = value[n:]
+	}
+	return result, nil
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/openapi"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// legacyPermCommandMsg is the message as decoded by consumers written before versioning, e.g. permission-search
+type legacyPermCommandMsg struct {
+	Command  string `json:"command"`
+	Kind     string
+	Resource string
+	User     string
+	Group    string
+	Right    string
+}
+
+var samples = []model.PermCommandMsg{
+	{Command: model.CommandPut, Kind: "devices", Resource: "urn:infai:ses:device:1", User: "u1", Right: "rwxa"},
+	{Command: model.CommandPut, Kind: "devices", Resource: "urn:infai:ses:device:1", Group: "user", Right: "rx"},
+	{Command: model.CommandPut, Kind: "devices", Resource: "urn:infai:ses:device:1", User: "u1", Right: ""},
+	{Command: model.CommandDelete, Kind: "processes", Resource: "p1", Group: "user"},
+}
+
+func versioned(cmd model.PermCommandMsg) model.PermCommandMsg {
+	cmd.Version = SchemaVersion
+	return cmd
+}
+
+func TestJsonMatchesSchema(t *testing.T) {
+	raw, err := os.ReadFile("permission_command.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := &openapi.Schema{}
+	err = json.Unmarshal(raw, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sample := range samples {
+		value, _, err := Encode(sample, EncodingJson)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var generic interface{}
+		decoder := json.NewDecoder(bytes.NewReader(value))
+		decoder.UseNumber()
+		err = decoder.Decode(&generic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = (&openapi.Document{}).ValidateValue(schema, generic, "message")
+		if err != nil {
+			t.Errorf("%s does not match the schema: %v", value, err)
+		}
+	}
+}
+
+func TestLegacyConsumersDecodeJson(t *testing.T) {
+	for _, sample := range samples {
+		value, _, err := Encode(sample, EncodingJson)
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacy := legacyPermCommandMsg{}
+		err = json.Unmarshal(value, &legacy)
+		expected := legacyPermCommandMsg{sample.Command, sample.Kind, sample.Resource, sample.User, sample.Group, sample.Right}
+		if err != nil || legacy != expected {
+			t.Errorf("legacy consumers decode %s as %+v, expected %+v (%v)", value, legacy, expected, err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, encoding := range []string{EncodingJson, EncodingProtobuf} {
+		for _, sample := range samples {
+			value, headers, err := Encode(sample, encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if headers[HeaderSchemaVersion] != "1" {
+				t.Errorf("%v: unexpected schema version header %v", encoding, headers[HeaderSchemaVersion])
+			}
+			decoded, err := Decode(value, headers[HeaderContentType])
+			if err != nil || decoded != versioned(sample) {
+				t.Errorf("%v: %+v decoded as %+v (%v)", encoding, sample, decoded, err)
+			}
+		}
+	}
+}
+
+func TestUnversionedMessagesAreDecoded(t *testing.T) {
+	for _, sample := range samples {
+		legacy, err := json.Marshal(legacyPermCommandMsg{sample.Command, sample.Kind, sample.Resource, sample.User, sample.Group, sample.Right})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, contentType := range []string{"", ContentTypeJson} {
+			decoded, err := Decode(legacy, contentType)
+			if err != nil || decoded != versioned(sample) {
+				t.Errorf("unversioned json %s with content-type %q decoded as %+v (%v)", legacy, contentType, decoded, err)
+			}
+		}
+
+		value := encodeProtobuf(sample)
+		decoded, err := Decode(value, ContentTypeProtobuf)
+		if err != nil || decoded != versioned(sample) {
+			t.Errorf("unversioned protobuf of %+v decoded as %+v (%v)", sample, decoded, err)
+		}
+	}
+}
+
+func TestUnknownFieldsAreSkipped(t *testing.T) {
+	for _, sample := range samples {
+		value, _, err := Encode(sample, EncodingJson)
+		if err != nil {
+			t.Fatal(err)
+		}
+		extended := map[string]interface{}{}
+		err = json.Unmarshal(value, &extended)
+		if err != nil {
+			t.Fatal(err)
+		}
+		extended["later"] = map[string]interface{}{"field": []int{1, 2}}
+		value, err = json.Marshal(extended)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := Decode(value, ContentTypeJson)
+		if err != nil || decoded != versioned(sample) {
+			t.Errorf("json with unknown field %s decoded as %+v (%v)", value, decoded, err)
+		}
+
+		value, _, err = Encode(sample, EncodingProtobuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value = protowire.AppendTag(value, 100, protowire.BytesType)
+		value = protowire.AppendString(value, "field of a later version")
+		value = protowire.AppendTag(value, 101, protowire.VarintType)
+		value = protowire.AppendVarint(value, 42)
+		value = protowire.AppendTag(value, 102, protowire.Fixed32Type)
+		value = protowire.AppendFixed32(value, 42)
+		value = protowire.AppendTag(value, 103, protowire.Fixed64Type)
+		value = protowire.AppendFixed64(value, 42)
+		decoded, err = Decode(value, ContentTypeProtobuf)
+		if err != nil || decoded != versioned(sample) {
+			t.Errorf("protobuf with unknown fields of %+v decoded as %+v (%v)", sample, decoded, err)
+		}
+	}
+}
+
+func TestUnknownContentType(t *testing.T) {
+	_, err := Decode([]byte("{}"), "application/xml")
+	if err == nil {
+		t.Error("expected error for unknown content-type")
+	}
+}
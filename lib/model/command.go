@@ -0,0 +1,57 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package model
+
+import "strings"
+
+const (
+	CommandPut    = "PUT"
+	CommandDelete = "DELETE"
+)
+
+// PermCommandMsg is the kafka message consumed by permission-search and other services,
+// see lib/message for its schema and encodings
+type PermCommandMsg struct {
+	Command  string `json:"command"`
+	Kind     string
+	Resource string
+	User     string
+	Group    string
+	Right    string
+	Version  int `json:"version,omitempty"` //schema version, missing in messages written before versioning (version 1)
+}
+
+// NormalizeRight returns the known rights of right in the canonical order r, w, x, a
+func NormalizeRight(right string) (result string) {
+	for _, r := range "rwxa" {
+		if strings.ContainsRune(right, r) {
+			result += string(r)
+		}
+	}
+	return result
+}
+
+// Command is a single permission change as accepted by the batch endpoint.
+// Exactly one of User and Group has to be set; Right is ignored for DELETE.
+type Command struct {
+	Command  string `json:"command"`
+	Kind     string `json:"kind"`
+	Resource string `json:"resource"`
+	User     string `json:"user,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Right    string `json:"right,omitempty"`
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/jobs"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+const JobTypeUserRemoval = "user_removal"
+
+// RemoveUserEverywhere starts a job deleting every right of the user known to the permission topic
+func RemoveUserEverywhere(token auth.Token, user string) (jobs.Job, error) {
+	t, err := getTenant(token)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	err = CheckCommand(token, PermCommandMsg{Command: model.CommandDelete, User: user})
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	return submitJob(JobTypeUserRemoval, t, token, func(ctx context.Context) (commands []model.Command, err error) {
+		grants, err := ReplayGrants(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range grants {
+			if grant.User == user {
+				commands = append(commands, model.Command{Command: model.CommandDelete, Kind: grant.Kind, Resource: grant.Resource, User: user})
+			}
+		}
+		return commands, nil
+	})
+}
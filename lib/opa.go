@@ -0,0 +1,124 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/opa"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+const (
+	OpaModeInstead   = "instead"   //opa replaces Authorizer
+	OpaModeAlongside = "alongside" //opa and Authorizer have to allow
+)
+
+var opaEvaluator opa.Evaluator
+var opaDecisionLog = log.New(os.Stdout, "[OPA-DECISION] ", 0)
+
+// InitOpa prepares the evaluator of Config.OpaBundlePath or Config.OpaUrl if Config.OpaMode is set
+func InitOpa() {
+	if Config.OpaMode == "" {
+		return
+	}
+	if Config.OpaMode != OpaModeInstead && Config.OpaMode != OpaModeAlongside {
+		log.Fatal("ERROR: unknown OpaMode ", Config.OpaMode)
+	}
+	timeout, err := time.ParseDuration(Config.OpaTimeout)
+	if err != nil {
+		log.Fatal("ERROR: invalid OpaTimeout ", err)
+	}
+	var evaluator opa.Evaluator
+	switch {
+	case Config.OpaBundlePath != "":
+		evaluator, err = opa.NewBundleEvaluator(context.Background(), Config.OpaBundlePath, Config.OpaQuery)
+		if err != nil {
+			log.Fatal("ERROR: unable to load opa bundle ", err)
+		}
+	case Config.OpaUrl != "":
+		evaluator = opa.NewHttpEvaluator(Config.OpaUrl, &http.Client{Timeout: timeout})
+	default:
+		log.Fatal("ERROR: OpaMode requires OpaUrl or OpaBundlePath")
+	}
+	opaEvaluator = opa.WithDecisionLog(evaluator, opaDecisionLog)
+}
+
+// OpaAuthorizer asks opa if the token may execute the command
+type OpaAuthorizer struct{}
+
+func (this OpaAuthorizer) HasAdminRight(token auth.Token, kind string, id string) error {
+	return this.AuthorizeCommand(token, PermCommandMsg{Kind: kind, Resource: id})
+}
+
+func (this OpaAuthorizer) AuthorizeCommand(token auth.Token, cmd PermCommandMsg) error {
+	if opaEvaluator == nil {
+		return problem.New(http.StatusInternalServerError, problem.Internal, "opa is not initialized")
+	}
+	claims, err := token.Claims()
+	if err != nil {
+		return problem.New(http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
+	}
+	operation := cmd.Command
+	if operation == "" {
+		operation = "READ"
+	}
+	timeout, _ := time.ParseDuration(Config.OpaTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	decision, err := opaEvaluator.Evaluate(ctx, opa.Input{
+		Token:     claims,
+		Operation: operation,
+		Target:    opa.Target{Kind: cmd.Kind, Resource: cmd.Resource, User: cmd.User, Group: cmd.Group, Right: model.NormalizeRight(cmd.Right)},
+	})
+	if err != nil {
+		return err
+	}
+	if !decision.Allow {
+		detail := "denied by opa"
+		if decision.Reason != "" {
+			detail += ": " + decision.Reason
+		}
+		p := problem.New(http.StatusForbidden, problem.NotResourceAdmin, detail)
+		p.Rule = "opa"
+		return p
+	}
+	return nil
+}
+
+// AllAuthorizers allows commands only if every authorizer allows them
+type AllAuthorizers []Authorizer
+
+func (this AllAuthorizers) HasAdminRight(token auth.Token, kind string, id string) error {
+	return this.AuthorizeCommand(token, PermCommandMsg{Kind: kind, Resource: id})
+}
+
+func (this AllAuthorizers) AuthorizeCommand(token auth.Token, cmd PermCommandMsg) error {
+	for _, authorizer := range this {
+		err := authorize(authorizer, token, cmd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opa
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// DecisionLogger writes one json line per decision
+type DecisionLogger struct {
+	evaluator Evaluator
+	logger    *log.Logger
+}
+
+type decisionLogEntry struct {
+	DecisionId string   `json:"decision_id"`
+	Time       string   `json:"time"`
+	Input      Input    `json:"input"`
+	Result     Decision `json:"result"`
+	Error      string   `json:"error,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+// claimsLogged are the token claims written to the decision log, other claims may contain personal data
+var claimsLogged = []string{"sub", "realm_access", "azp", "iss"}
+
+func WithDecisionLog(evaluator Evaluator, logger *log.Logger) *DecisionLogger {
+	return &DecisionLogger{evaluator: evaluator, logger: logger}
+}
+
+func (this *DecisionLogger) Evaluate(ctx context.Context, input Input) (Decision, error) {
+	start := time.Now()
+	result, err := this.evaluator.Evaluate(ctx, input)
+	entry := decisionLogEntry{
+		DecisionId: newDecisionId(),
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		Input:      input,
+		Result:     result,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	entry.Input.Token = map[string]interface{}{}
+	for _, claim := range claimsLogged {
+		if value, ok := input.Token[claim]; ok {
+			entry.Input.Token[claim] = value
+		}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	line, _ := json.Marshal(entry)
+	this.logger.Println(string(line))
+	return result, err
+}
+
+func newDecisionId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
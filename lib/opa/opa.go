@@ -0,0 +1,146 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package opa asks Open Policy Agent for authorization decisions, either an OPA server or a rego bundle loaded from disk.
+package opa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// Input is sent as input document to the policy
+type Input struct {
+	Token     map[string]interface{} `json:"token"`     //claims of the requesting token
+	Operation string                 `json:"operation"` //PUT, DELETE or READ
+	Target    Target                 `json:"target"`
+}
+
+type Target struct {
+	Kind     string `json:"kind"`
+	Resource string `json:"resource"`
+	User     string `json:"user,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Right    string `json:"right,omitempty"`
+}
+
+// Decision is read from policy results which are either a boolean or an object {"allow": bool, "reason": string}.
+// An undefined result denies.
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type Evaluator interface {
+	Evaluate(ctx context.Context, input Input) (Decision, error)
+}
+
+// HttpEvaluator uses the data api of an OPA server, e.g. http://opa:8181/v1/data/senergy/permission/allow
+type HttpEvaluator struct {
+	url    string
+	client *http.Client
+}
+
+func NewHttpEvaluator(url string, client *http.Client) *HttpEvaluator {
+	return &HttpEvaluator{url: url, client: client}
+}
+
+func (this *HttpEvaluator) Evaluate(ctx context.Context, input Input) (result Decision, err error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return result, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, this.url, bytes.NewReader(body))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return result, errors.New("unexpected opa response " + strconv.Itoa(resp.StatusCode))
+	}
+	response := struct {
+		Result interface{} `json:"result"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return result, err
+	}
+	return toDecision(response.Result)
+}
+
+// BundleEvaluator evaluates a rego bundle (directory or .tar.gz) in process
+type BundleEvaluator struct {
+	query rego.PreparedEvalQuery
+}
+
+// NewBundleEvaluator loads the bundle at path and prepares query, e.g. data.senergy.permission.allow
+func NewBundleEvaluator(ctx context.Context, path string, query string) (*BundleEvaluator, error) {
+	prepared, err := rego.New(rego.Query(query), rego.LoadBundle(path)).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &BundleEvaluator{query: prepared}, nil
+}
+
+func (this *BundleEvaluator) Evaluate(ctx context.Context, input Input) (result Decision, err error) {
+	//the input has to be a plain json document for rego
+	var document interface{}
+	temp, err := json.Marshal(input)
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(temp, &document)
+	if err != nil {
+		return result, err
+	}
+	results, err := this.query.Eval(ctx, rego.EvalInput(document))
+	if err != nil {
+		return result, err
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return Decision{Allow: false, Reason: "undefined"}, nil
+	}
+	return toDecision(results[0].Expressions[0].Value)
+}
+
+func toDecision(value interface{}) (result Decision, err error) {
+	switch v := value.(type) {
+	case nil:
+		return Decision{Allow: false, Reason: "undefined"}, nil
+	case bool:
+		return Decision{Allow: v}, nil
+	case map[string]interface{}:
+		allow, ok := v["allow"].(bool)
+		if !ok {
+			return result, errors.New("opa result object without boolean allow")
+		}
+		reason, _ := v["reason"].(string)
+		return Decision{Allow: allow, Reason: reason}, nil
+	default:
+		return result, errors.New("unexpected opa result type")
+	}
+}
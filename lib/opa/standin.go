@@ -0,0 +1,74 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package opa
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// StandIn is a minimal OPA server for tests: it answers every POST of the data api with the decision of Decide.
+// Start it with httptest.NewServer(opa.NewStandIn(...)) and use the server url as OpaUrl.
+type StandIn struct {
+	Decide func(input Input) Decision
+	mux    sync.Mutex
+	inputs []Input
+}
+
+func NewStandIn(decide func(input Input) Decision) *StandIn {
+	return &StandIn{Decide: decide}
+}
+
+// AllowAdmins allows everything to tokens with the admin realm role, like the example policy of the README
+func AllowAdmins(input Input) Decision {
+	access, _ := input.Token["realm_access"].(map[string]interface{})
+	roles, _ := access["roles"].([]interface{})
+	for _, role := range roles {
+		if role == "admin" {
+			return Decision{Allow: true}
+		}
+	}
+	return Decision{Allow: false, Reason: "admin role required"}
+}
+
+// Inputs returns every received input, in order
+func (this *StandIn) Inputs() []Input {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return append([]Input{}, this.inputs...)
+}
+
+func (this *StandIn) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(res, "expected POST", http.StatusMethodNotAllowed)
+		return
+	}
+	body := struct {
+		Input Input `json:"input"`
+	}{}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	this.mux.Lock()
+	this.inputs = append(this.inputs, body.Input)
+	this.mux.Unlock()
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(map[string]interface{}{"result": this.Decide(body.Input)})
+}
@@ -0,0 +1,260 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/opa"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/golang-jwt/jwt"
+)
+
+func testToken(t *testing.T, sub string, roles ...string) auth.Token {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":          sub,
+		"email":        sub + "@example.com",
+		"realm_access": map[string]interface{}{"roles": roles},
+	}).SignedString([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.Parse("Bearer " + signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+type opaTestEnv struct {
+	standIn          *opa.StandIn
+	permSearchCalls  *atomic.Int32
+	decisionLog      *bytes.Buffer
+	permSearchAllows map[string]bool
+}
+
+// setupOpa starts the opa stand-in and a permission-search answering with permSearchAllows by user
+func setupOpa(t *testing.T, mode string, decide func(input opa.Input) opa.Decision, permSearchAllows map[string]bool) opaTestEnv {
+	err := LoadConfig("../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := opaTestEnv{
+		standIn:          opa.NewStandIn(decide),
+		permSearchCalls:  &atomic.Int32{},
+		decisionLog:      &bytes.Buffer{},
+		permSearchAllows: permSearchAllows,
+	}
+	opaServer := httptest.NewServer(env.standIn)
+	t.Cleanup(opaServer.Close)
+	permSearch := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		env.permSearchCalls.Add(1)
+		token, err := auth.Parse(req.Header.Get("Authorization"))
+		if err != nil || !env.permSearchAllows[token.Sub] {
+			res.WriteHeader(http.StatusForbidden)
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(permSearch.Close)
+
+	Config.OpaMode = mode
+	Config.OpaUrl = opaServer.URL
+	Config.PermissionsViewUrl = permSearch.URL
+	opaDecisionLog.SetOutput(env.decisionLog)
+	InitOpa()
+	t.Cleanup(func() {
+		opaEvaluator = nil
+		opaDecisionLog.SetOutput(os.Stdout)
+	})
+	return env
+}
+
+var opaTestCmd = PermCommandMsg{Command: "PUT", Kind: "devices", Resource: "d1", User: "u2", Right: "rx"}
+
+func requireProblem(t *testing.T, err error, status int, code problem.Code, rule string) {
+	t.Helper()
+	var p problem.Problem
+	if !errors.As(err, &p) {
+		t.Fatalf("expected problem %v, got %v", code, err)
+	}
+	if p.Status != status || p.Code != code || p.Rule != rule {
+		t.Fatalf("expected %v %v rule %q, got %v %v rule %q (%v)", status, code, rule, p.Status, p.Code, p.Rule, p.Detail)
+	}
+}
+
+func TestOpaInstead(t *testing.T) {
+	env := setupOpa(t, OpaModeInstead, opa.AllowAdmins, map[string]bool{"user": true})
+
+	err := AuthorizeCommand(testToken(t, "admin", "admin"), opaTestCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AuthorizeCommand(testToken(t, "user", "user"), opaTestCmd)
+	requireProblem(t, err, http.StatusForbidden, problem.NotResourceAdmin, "opa")
+	if !strings.Contains(err.Error(), "admin role required") {
+		t.Error("expected the reason of opa in the detail, got", err)
+	}
+
+	if calls := env.permSearchCalls.Load(); calls != 0 {
+		t.Error("permission-search must not be asked in instead mode, got calls:", calls)
+	}
+	inputs := env.standIn.Inputs()
+	if len(inputs) != 2 {
+		t.Fatal("expected 2 opa inputs, got", len(inputs))
+	}
+	expected := opa.Target{Kind: "devices", Resource: "d1", User: "u2", Right: "rx"}
+	if inputs[0].Operation != "PUT" || inputs[0].Target != expected || inputs[0].Token["sub"] != "admin" {
+		t.Errorf("unexpected opa input %+v", inputs[0])
+	}
+}
+
+func TestOpaAlongside(t *testing.T) {
+	env := setupOpa(t, OpaModeAlongside, opa.AllowAdmins, map[string]bool{"admin": true, "owner": true})
+
+	err := AuthorizeCommand(testToken(t, "admin", "admin"), opaTestCmd)
+	if err != nil {
+		t.Fatal("expected allow if both allow, got", err)
+	}
+	err = AuthorizeCommand(testToken(t, "owner", "user"), opaTestCmd)
+	requireProblem(t, err, http.StatusForbidden, problem.NotResourceAdmin, "opa")
+
+	calls := len(env.standIn.Inputs())
+	err = AuthorizeCommand(testToken(t, "other", "admin"), opaTestCmd)
+	requireProblem(t, err, http.StatusForbidden, problem.NotResourceAdmin, "")
+	if len(env.standIn.Inputs()) != calls {
+		t.Error("opa must not be asked after permission-search denied")
+	}
+	if env.permSearchCalls.Load() != 3 {
+		t.Error("expected permission-search to be asked for every command, got", env.permSearchCalls.Load())
+	}
+}
+
+func TestOpaReadOperation(t *testing.T) {
+	env := setupOpa(t, OpaModeInstead, opa.AllowAdmins, nil)
+	err := GetAuthorizer().HasAdminRight(testToken(t, "admin", "admin"), "devices", "d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := env.standIn.Inputs()
+	if len(inputs) != 1 || inputs[0].Operation != "READ" {
+		t.Errorf("expected READ input, got %+v", inputs)
+	}
+}
+
+func TestOpaDecisionLog(t *testing.T) {
+	env := setupOpa(t, OpaModeInstead, opa.AllowAdmins, nil)
+	_ = AuthorizeCommand(testToken(t, "admin", "admin"), opaTestCmd)
+	_ = AuthorizeCommand(testToken(t, "user", "user"), opaTestCmd)
+
+	lines := strings.Split(strings.TrimSpace(env.decisionLog.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one decision log line per decision, got %q", env.decisionLog.String())
+	}
+	ids := map[string]bool{}
+	for i, allow := range []bool{true, false} {
+		entry := struct {
+			DecisionId string                 `json:"decision_id"`
+			Input      map[string]interface{} `json:"input"`
+			Result     opa.Decision           `json:"result"`
+			Error      string                 `json:"error"`
+		}{}
+		err := json.Unmarshal([]byte(strings.TrimPrefix(lines[i], "[OPA-DECISION] ")), &entry)
+		if err != nil {
+			t.Fatal(err, lines[i])
+		}
+		if entry.DecisionId == "" || ids[entry.DecisionId] {
+			t.Error("expected unique decision id, got", entry.DecisionId)
+		}
+		ids[entry.DecisionId] = true
+		if entry.Result.Allow != allow || entry.Error != "" {
+			t.Errorf("unexpected logged result %+v %v", entry.Result, entry.Error)
+		}
+		token, _ := entry.Input["token"].(map[string]interface{})
+		if token["sub"] == nil || token["realm_access"] == nil {
+			t.Error("expected sub and realm_access in the decision log, got", token)
+		}
+		if token["email"] != nil {
+			t.Error("claims with personal data must not be logged, got", token)
+		}
+	}
+}
+
+func TestOpaErrors(t *testing.T) {
+	env := setupOpa(t, OpaModeInstead, opa.AllowAdmins, nil)
+
+	t.Run("unexpected status", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer failing.Close()
+		Config.OpaUrl = failing.URL
+		InitOpa()
+		env.decisionLog.Reset()
+		err := AuthorizeCommand(testToken(t, "admin", "admin"), opaTestCmd)
+		requireProblem(t, err, http.StatusBadGateway, problem.PermissionCheckFailed, "")
+		if !strings.Contains(env.decisionLog.String(), `"error":"unexpected opa response 500"`) {
+			t.Error("expected the error in the decision log, got", env.decisionLog.String())
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		Config.OpaUrl = closed.URL
+		InitOpa()
+		err := AuthorizeCommand(testToken(t, "admin", "admin"), opaTestCmd)
+		requireProblem(t, err, http.StatusBadGateway, problem.PermissionCheckFailed, "")
+	})
+
+	t.Run("invalid result", func(t *testing.T) {
+		invalid := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte(`{"result": {"reason": "allow is missing"}}`))
+		}))
+		defer invalid.Close()
+		Config.OpaUrl = invalid.URL
+		InitOpa()
+		err := AuthorizeCommand(testToken(t, "admin", "admin"), opaTestCmd)
+		requireProblem(t, err, http.StatusBadGateway, problem.PermissionCheckFailed, "")
+	})
+
+	t.Run("undefined result denies", func(t *testing.T) {
+		undefined := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte(`{}`))
+		}))
+		defer undefined.Close()
+		Config.OpaUrl = undefined.URL
+		InitOpa()
+		err := AuthorizeCommand(testToken(t, "admin", "admin"), opaTestCmd)
+		requireProblem(t, err, http.StatusForbidden, problem.NotResourceAdmin, "opa")
+	})
+
+	t.Run("not initialized", func(t *testing.T) {
+		opaEvaluator = nil
+		err := AuthorizeCommand(testToken(t, "admin", "admin"), opaTestCmd)
+		requireProblem(t, err, http.StatusInternalServerError, problem.Internal, "")
+	})
+}
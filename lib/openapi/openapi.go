@@ -0,0 +1,180 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Document is the subset of the OpenAPI 3.0 object model used by this service
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationId string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` //path | query | header
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+	Streamed    bool                  `json:"-"` //the handler validates the body while reading it, so it is not buffered
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            int                `json:"minLength,omitempty"`
+	MinItems             int                `json:"minItems,omitempty"`
+	MaxItems             int                `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func JsonContent(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: schema}}
+}
+
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]*SecurityScheme{},
+		},
+	}
+}
+
+var routerParam = regexp.MustCompile(`[:*]([^/]+)`)
+
+// PathFromRouter translates httprouter path syntax (/user/:user) to OpenAPI path templates (/user/{user})
+func PathFromRouter(path string) string {
+	return routerParam.ReplaceAllString(path, "{$1}")
+}
+
+// RouterPathParams returns the parameter names used in an httprouter path
+func RouterPathParams(path string) (result []string) {
+	for _, match := range routerParam.FindAllStringSubmatch(path, -1) {
+		result = append(result, match[1])
+	}
+	return result
+}
+
+// Add registers the operation for the given method and httprouter path.
+// It returns an error if the operation is incomplete or does not match the path parameters of the route.
+func (this *Document) Add(method string, routerPath string, op *Operation) error {
+	if op == nil {
+		return fmt.Errorf("missing openapi operation for %v %v", method, routerPath)
+	}
+	if op.OperationId == "" {
+		return fmt.Errorf("missing operationId for %v %v", method, routerPath)
+	}
+	if len(op.Responses) == 0 {
+		return fmt.Errorf("missing responses for %v %v", method, routerPath)
+	}
+	documented := []string{}
+	for _, param := range op.Parameters {
+		if param.In == "path" {
+			documented = append(documented, param.Name)
+		}
+	}
+	used := RouterPathParams(routerPath)
+	sort.Strings(documented)
+	sort.Strings(used)
+	if strings.Join(documented, ",") != strings.Join(used, ",") {
+		return fmt.Errorf("path parameters of %v %v are documented as %v but the route uses %v", method, routerPath, documented, used)
+	}
+	for _, existing := range this.Paths {
+		for _, other := range *existing {
+			if other.OperationId == op.OperationId {
+				return fmt.Errorf("duplicate operationId %v", op.OperationId)
+			}
+		}
+	}
+	path := PathFromRouter(routerPath)
+	item, ok := this.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		this.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+	return nil
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ValidationError describes the first violation found while validating a request
+type ValidationError struct {
+	Location string
+	Message  string
+}
+
+func (this ValidationError) Error() string {
+	return this.Location + ": " + this.Message
+}
+
+// ValidateRequest checks path, query and header parameters as well as a json request body against op.
+// pathParams maps path parameter names to their values. A validated body is restored so handlers may read it again.
+// A *http.MaxBytesError of a body limited by http.MaxBytesReader is returned unchanged.
+func (this *Document) ValidateRequest(op *Operation, req *http.Request, pathParams map[string]string) error {
+	query := req.URL.Query()
+	for _, param := range op.Parameters {
+		var value string
+		var present bool
+		switch param.In {
+		case "path":
+			value, present = pathParams[param.Name]
+		case "query":
+			present = query.Has(param.Name)
+			value = query.Get(param.Name)
+		case "header":
+			value = req.Header.Get(param.Name)
+			present = value != ""
+		}
+		location := param.In + "." + param.Name
+		if !present {
+			if param.Required {
+				return ValidationError{Location: location, Message: "is required"}
+			}
+			continue
+		}
+		err := this.validateParameter(param.Schema, value, location)
+		if err != nil {
+			return err
+		}
+	}
+	if op.RequestBody == nil {
+		return nil
+	}
+	if op.RequestBody.Streamed {
+		_, err := mediaTypeOf(op.RequestBody, req)
+		return err
+	}
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	body, err := io.ReadAll(req.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	if err != nil {
+		return ValidationError{Location: "body", Message: err.Error()}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return ValidationError{Location: "body", Message: "is required"}
+		}
+		return nil
+	}
+	mediaType, err := mediaTypeOf(op.RequestBody, req)
+	if err != nil {
+		return err
+	}
+	media := op.RequestBody.Content[mediaType]
+	// other media types than json have to be validated by the handler
+	if mediaType != "application/json" || media.Schema == nil {
+		return nil
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	err = decoder.Decode(&value)
+	if err != nil {
+		return ValidationError{Location: "body", Message: "invalid json: " + err.Error()}
+	}
+	return this.ValidateValue(media.Schema, value, "body")
+}
+
+// mediaTypeOf returns the media type of the Content-Type header (default application/json) if body accepts it
+func mediaTypeOf(body *RequestBody, req *http.Request) (string, error) {
+	mediaType := "application/json"
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	if _, ok := body.Content[mediaType]; !ok {
+		supported := []string{}
+		for key := range body.Content {
+			supported = append(supported, key)
+		}
+		sort.Strings(supported)
+		return "", ValidationError{Location: "header.Content-Type", Message: "expected one of " + strings.Join(supported, ", ")}
+	}
+	return mediaType, nil
+}
+
+func (this *Document) validateParameter(schema *Schema, value string, location string) error {
+	schema = this.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	switch schema.Type {
+	case "integer":
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return ValidationError{Location: location, Message: "expected integer"}
+		}
+		return this.ValidateValue(schema, json.Number(strconv.FormatInt(i, 10)), location)
+	case "number":
+		_, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return ValidationError{Location: location, Message: "expected number"}
+		}
+		return this.ValidateValue(schema, json.Number(value), location)
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return ValidationError{Location: location, Message: "expected boolean"}
+		}
+		return this.ValidateValue(schema, b, location)
+	default:
+		return this.ValidateValue(schema, value, location)
+	}
+}
+
+// ValidateValue validates a decoded json value (numbers as json.Number) against schema
+func (this *Document) ValidateValue(schema *Schema, value interface{}, location string) error {
+	schema = this.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return ValidationError{Location: location, Message: "expected string"}
+		}
+		if len(s) < schema.MinLength {
+			return ValidationError{Location: location, Message: fmt.Sprintf("expected at least %v characters", schema.MinLength)}
+		}
+		if schema.Pattern != "" && !compile(schema.Pattern).MatchString(s) {
+			return ValidationError{Location: location, Message: "does not match " + schema.Pattern}
+		}
+		if len(schema.Enum) > 0 && !contains(schema.Enum, s) {
+			return ValidationError{Location: location, Message: "expected one of " + strings.Join(schema.Enum, ", ")}
+		}
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return ValidationError{Location: location, Message: "expected " + schema.Type}
+		}
+		if schema.Type == "integer" {
+			if _, err := n.Int64(); err != nil {
+				return ValidationError{Location: location, Message: "expected integer"}
+			}
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return ValidationError{Location: location, Message: "expected number"}
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return ValidationError{Location: location, Message: fmt.Sprintf("expected value >= %v", *schema.Minimum)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return ValidationError{Location: location, Message: "expected boolean"}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return ValidationError{Location: location, Message: "expected array"}
+		}
+		if len(list) < schema.MinItems {
+			return ValidationError{Location: location, Message: fmt.Sprintf("expected at least %v items", schema.MinItems)}
+		}
+		if schema.MaxItems > 0 && len(list) > schema.MaxItems {
+			return ValidationError{Location: location, Message: fmt.Sprintf("expected at most %v items", schema.MaxItems)}
+		}
+		for i, element := range list {
+			err := this.ValidateValue(schema.Items, element, location+"["+strconv.Itoa(i)+"]")
+			if err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return ValidationError{Location: location, Message: "expected object"}
+		}
+		for _, field := range schema.Required {
+			if _, ok := obj[field]; !ok {
+				return ValidationError{Location: location + "." + field, Message: "is required"}
+			}
+		}
+		for key, element := range obj {
+			sub, ok := schema.Properties[key]
+			if !ok {
+				sub = schema.AdditionalProperties
+			}
+			err := this.ValidateValue(sub, element, location+"."+key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (this *Document) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = this.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+var patternCache = sync.Map{}
+
+func compile(pattern string) *regexp.Regexp {
+	if cached, ok := patternCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	result := regexp.MustCompile(pattern)
+	patternCache.Store(pattern, result)
+	return result
+}
+
+func contains(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
@@ -17,27 +17,104 @@
 package lib
 
 import (
+	"fmt"
 	"net/http"
 	"runtime/debug"
 
 	"net/url"
 
 	"errors"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+)
+
+var ErrAccessDenied = errors.New("access denied")
+
+const (
+	AuthorizerPermissionSearch = "permission-search"
+	AuthorizerProjection       = "projection"
 )
 
+// Authorizer decides if a token may administrate a resource; it returns ErrAccessDenied if not
+type Authorizer interface {
+	HasAdminRight(token auth.Token, kind string, id string) error
+}
+
+// CommandAuthorizer is implemented by authorizers deciding on the whole command instead of the resource only
+type CommandAuthorizer interface {
+	AuthorizeCommand(token auth.Token, cmd PermCommandMsg) error
+}
+
+func GetAuthorizer() Authorizer {
+	var result Authorizer = PermissionSearchAuthorizer{}
+	if Config.Authorizer == AuthorizerProjection {
+		result = ProjectionAuthorizer{}
+	}
+	if len(Config.DelegationKinds) > 0 {
+		result = DelegatingAuthorizer{result}
+	}
+	switch Config.OpaMode {
+	case OpaModeInstead:
+		return OpaAuthorizer{}
+	case OpaModeAlongside:
+		return AllAuthorizers{result, OpaAuthorizer{}}
+	}
+	return result
+}
+
+func authorize(authorizer Authorizer, token auth.Token, cmd PermCommandMsg) error {
+	if commandAuthorizer, ok := authorizer.(CommandAuthorizer); ok {
+		return commandAuthorizer.AuthorizeCommand(token, cmd)
+	}
+	return authorizer.HasAdminRight(token, cmd.Kind, cmd.Resource)
+}
+
+type PermissionSearchAuthorizer struct{}
+
+func (this PermissionSearchAuthorizer) HasAdminRight(token auth.Token, kind string, id string) error {
+	return this.HasRights(token, kind, id, "a")
+}
+
+// HasRights asks the permission-search of the tenant of the token
+func (this PermissionSearchAuthorizer) HasRights(token auth.Token, kind string, id string, rights string) error {
+	t, err := getTenant(token)
+	if err != nil {
+		return err
+	}
+	return hasRights(getPermissionsViewUrl(t), token.Token, kind, id, rights)
+}
+
 func HasAdminRight(impersonate string, kind string, id string) error {
-	if Config.PermissionsViewUrl == "" {
+	return HasRights(impersonate, kind, id, "a")
+}
+
+// HasRights asks permission-search if the impersonated token holds every right of rights on the resource;
+// only 401, 403 and 404 responses are reported as ErrAccessDenied
+func HasRights(impersonate string, kind string, id string, rights string) error {
+	return hasRights(Config.PermissionsViewUrl, impersonate, kind, id, rights)
+}
+
+func hasRights(permissionsViewUrl string, impersonate string, kind string, id string, rights string) error {
+	if permissionsViewUrl == "" {
 		return nil
 	}
-	req, err := http.NewRequest("HEAD", Config.PermissionsViewUrl + "/v3/resources/"+url.QueryEscape(kind)+"/"+url.QueryEscape(id)+"?rights=a", nil)
+	req, err := http.NewRequest("HEAD", permissionsViewUrl+"/v3/resources/"+url.QueryEscape(kind)+"/"+url.QueryEscape(id)+"?rights="+url.QueryEscape(rights), nil)
 	if err != nil {
 		debug.PrintStack()
 		return err
 	}
 	req.Header.Set("Authorization", impersonate)
 	resp, err := http.DefaultClient.Do(req)
-	if err == nil && resp.StatusCode != http.StatusOK {
-		err = errors.New("access denied")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return ErrAccessDenied
+	default:
+		return fmt.Errorf("unexpected response %v from permission-search", resp.StatusCode)
 	}
-	return err
 }
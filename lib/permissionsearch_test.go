@@ -0,0 +1,71 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lib
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+func TestHasRightsStatusMapping(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	cases := map[int]error{
+		http.StatusOK:           nil,
+		http.StatusUnauthorized: ErrAccessDenied,
+		http.StatusForbidden:    ErrAccessDenied,
+		http.StatusNotFound:     ErrAccessDenied,
+	}
+	for code, expected := range cases {
+		status = code
+		if err := hasRights(server.URL, "token", "devices", "d1", "a"); !errors.Is(err, expected) {
+			t.Errorf("%v: expected %v, got %v", code, expected, err)
+		}
+	}
+	for _, code := range []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusTooManyRequests} {
+		status = code
+		if err := hasRights(server.URL, "token", "devices", "d1", "a"); err == nil || errors.Is(err, ErrAccessDenied) {
+			t.Errorf("%v: expected upstream error, got %v", code, err)
+		}
+	}
+}
+
+func TestAuthorizeCommandReportsUnavailablePermissionSearch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+	old := Config
+	Config = &ConfigStruct{PermissionsViewUrl: server.URL}
+	t.Cleanup(func() {
+		Config = old
+	})
+
+	err := AuthorizeCommand(testToken(t, "u1", "user"), PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u2", Right: "r"})
+	var p problem.Problem
+	if !errors.As(err, &p) || p.Status != http.StatusBadGateway || p.Code != problem.PermissionCheckFailed {
+		t.Errorf("expected %v problem, got %v", problem.PermissionCheckFailed, err)
+	}
+}
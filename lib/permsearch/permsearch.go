@@ -0,0 +1,102 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package permsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("resource not found")
+
+// Right mirrors the right representation of permission-search
+type Right struct {
+	Read         bool `json:"read"`
+	Write        bool `json:"write"`
+	Execute      bool `json:"execute"`
+	Administrate bool `json:"administrate"`
+}
+
+// String returns the right in the r/w/x/a notation used by permission commands
+func (this Right) String() string {
+	result := ""
+	if this.Read {
+		result += "r"
+	}
+	if this.Write {
+		result += "w"
+	}
+	if this.Execute {
+		result += "x"
+	}
+	if this.Administrate {
+		result += "a"
+	}
+	return result
+}
+
+func ParseRight(right string) Right {
+	return Right{
+		Read:         strings.Contains(right, "r"),
+		Write:        strings.Contains(right, "w"),
+		Execute:      strings.Contains(right, "x"),
+		Administrate: strings.Contains(right, "a"),
+	}
+}
+
+type ResourceRights struct {
+	UserRights  map[string]Right `json:"user_rights"`
+	GroupRights map[string]Right `json:"group_rights"`
+}
+
+type Client struct {
+	url        string
+	httpClient *http.Client
+}
+
+func New(permissionSearchUrl string) *Client {
+	return &Client{url: strings.TrimSuffix(permissionSearchUrl, "/"), httpClient: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// GetRights returns all user and group rights of the resource; the token needs the administration right
+func (this *Client) GetRights(token string, kind string, id string) (result ResourceRights, err error) {
+	req, err := http.NewRequest(http.MethodGet, this.url+"/v3/administrate/rights/"+url.PathEscape(kind)+"/"+url.PathEscape(id), nil)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Authorization", token)
+	resp, err := this.httpClient.Do(req)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return result, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return result, fmt.Errorf("permission-search responded with %v: %v", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
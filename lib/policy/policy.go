@@ -0,0 +1,118 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package policy evaluates the rules permission commands have to follow before the administration right is checked.
+// Rules are declared in Config; further rules can be added with Engine.Register.
+package policy
+
+import (
+	"slices"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/projection"
+)
+
+// DefaultKind holds the policy of kinds without own entry in Config.Kinds
+const DefaultKind = "*"
+
+type Config struct {
+	ProtectedGroups []string              `json:"protected_groups"` //only tokens with the admin role may remove these groups or their right "a"
+	DeniedUsers     []string              `json:"denied_users"`     //may not receive rights
+	DeniedGroups    []string              `json:"denied_groups"`
+	Kinds           map[string]KindPolicy `json:"kinds"`
+}
+
+type KindPolicy struct {
+	Rights                    string `json:"rights"`                      //valid rights, empty allows rwxa
+	AdministrateRequiresAdmin bool   `json:"administrate_requires_admin"` //only tokens with the admin role may grant "a"
+	MaxGrantees               int    `json:"max_grantees"`                //users and groups per resource, 0 is unlimited
+}
+
+// DefaultConfig protects the admin group, as before policies were configurable
+func DefaultConfig() Config {
+	return Config{ProtectedGroups: []string{"admin"}}
+}
+
+func (this Config) Kind(kind string) KindPolicy {
+	if policy, ok := this.Kinds[kind]; ok {
+		return policy
+	}
+	return this.Kinds[DefaultKind]
+}
+
+func (this Config) IsProtectedGroup(group string) bool {
+	return slices.Contains(this.ProtectedGroups, group)
+}
+
+// Request is a permission command together with the requesting token
+type Request struct {
+	UserId  string
+	IsAdmin bool
+	Command model.PermCommandMsg
+	// Current returns the current rights of the resource; nil if they are not known,
+	// rules depending on them are skipped (e.g. for local checks of command line tools)
+	Current func() (projection.Resource, error)
+}
+
+// Rule returns a problem with its Rule set to Id if the request violates the rule
+type Rule interface {
+	Id() string
+	Evaluate(config Config, request Request) error
+}
+
+type Engine struct {
+	config Config
+	rules  []Rule
+}
+
+// New returns an engine evaluating the builtin rules
+func New(config Config) *Engine {
+	return &Engine{config: config, rules: []Rule{
+		SelfAdminRemoval{},
+		ProtectedGroup{},
+		DeniedPrincipal{},
+		ValidRights{},
+		AdministrateGrant{},
+		MaxGrantees{},
+	}}
+}
+
+func (this *Engine) Config() Config {
+	return this.config
+}
+
+// Register adds a rule evaluated after the builtin rules
+func (this *Engine) Register(rule Rule) {
+	this.rules = append(this.rules, rule)
+}
+
+// Evaluate returns the violation of the first failing rule
+func (this *Engine) Evaluate(request Request) error {
+	for _, rule := range this.rules {
+		err := rule.Evaluate(this.config, request)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func violation(rule Rule, status int, code problem.Code, detail string) problem.Problem {
+	p := problem.New(status, code, detail)
+	p.Rule = rule.Id()
+	return p
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package policy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+)
+
+// grants is true for PUT commands which leave the principal with a right
+func grants(cmd model.PermCommandMsg) bool {
+	return cmd.Command == model.CommandPut && model.NormalizeRight(cmd.Right) != ""
+}
+
+// SelfAdminRemoval prevents users from removing their own administration right
+type SelfAdminRemoval struct{}
+
+func (this SelfAdminRemoval) Id() string {
+	return "self-admin-removal"
+}
+
+func (this SelfAdminRemoval) Evaluate(config Config, request Request) error {
+	cmd := request.Command
+	if cmd.User == "" || cmd.User != request.UserId {
+		return nil
+	}
+	if cmd.Command == model.CommandDelete {
+		return violation(this, http.StatusBadRequest, problem.SelfAdminRemoval, "user cant remove his own rights")
+	}
+	if !strings.Contains(cmd.Right, "a") {
+		return violation(this, http.StatusBadRequest, problem.SelfAdminRemoval, "user cant remove own administration right")
+	}
+	return nil
+}
+
+// ProtectedGroup prevents tokens without admin role from removing a protected group or its administration right
+type ProtectedGroup struct{}
+
+func (this ProtectedGroup) Id() string {
+	return "protected-group"
+}
+
+func (this ProtectedGroup) Evaluate(config Config, request Request) error {
+	cmd := request.Command
+	if request.IsAdmin || !config.IsProtectedGroup(cmd.Group) {
+		return nil
+	}
+	if cmd.Command == model.CommandDelete || !strings.Contains(cmd.Right, "a") {
+		return violation(this, http.StatusForbidden, problem.AdminGroupProtected, "only admins may remove the protected group "+cmd.Group+" from a resource")
+	}
+	return nil
+}
+
+// DeniedPrincipal prevents granting rights to denied users and groups; removing their rights stays possible
+type DeniedPrincipal struct{}
+
+func (this DeniedPrincipal) Id() string {
+	return "denied-principal"
+}
+
+func (this DeniedPrincipal) Evaluate(config Config, request Request) error {
+	cmd := request.Command
+	if !grants(cmd) {
+		return nil
+	}
+	for _, user := range config.DeniedUsers {
+		if cmd.User == user {
+			return violation(this, http.StatusForbidden, problem.PolicyViolation, "user "+user+" may not receive rights")
+		}
+	}
+	for _, group := range config.DeniedGroups {
+		if cmd.User == "" && cmd.Group == group {
+			return violation(this, http.StatusForbidden, problem.PolicyViolation, "group "+group+" may not receive rights")
+		}
+	}
+	return nil
+}
+
+// ValidRights restricts the rights which may be granted for a kind
+type ValidRights struct{}
+
+func (this ValidRights) Id() string {
+	return "valid-rights"
+}
+
+func (this ValidRights) Evaluate(config Config, request Request) error {
+	cmd := request.Command
+	valid := config.Kind(cmd.Kind).Rights
+	if cmd.Command != model.CommandPut || valid == "" {
+		return nil
+	}
+	for _, r := range cmd.Right {
+		if !strings.ContainsRune(valid, r) {
+			return violation(this, http.StatusBadRequest, problem.PolicyViolation, "right "+string(r)+" is not valid for "+cmd.Kind+", expected any of "+valid)
+		}
+	}
+	return nil
+}
+
+// AdministrateGrant restricts granting "a" to tokens with the admin role, if configured for the kind
+type AdministrateGrant struct{}
+
+func (this AdministrateGrant) Id() string {
+	return "administrate-grant"
+}
+
+func (this AdministrateGrant) Evaluate(config Config, request Request) error {
+	cmd := request.Command
+	if request.IsAdmin || !config.Kind(cmd.Kind).AdministrateRequiresAdmin {
+		return nil
+	}
+	//users keep their own administration right, see SelfAdminRemoval
+	if cmd.Command == model.CommandPut && strings.Contains(cmd.Right, "a") && cmd.User != request.UserId {
+		return violation(this, http.StatusForbidden, problem.PolicyViolation, "only admins may grant the administration right for "+cmd.Kind)
+	}
+	return nil
+}
+
+// MaxGrantees limits the number of users and groups holding rights on a resource
+type MaxGrantees struct{}
+
+func (this MaxGrantees) Id() string {
+	return "max-grantees"
+}
+
+func (this MaxGrantees) Evaluate(config Config, request Request) error {
+	cmd := request.Command
+	max := config.Kind(cmd.Kind).MaxGrantees
+	if max <= 0 || !grants(cmd) || request.Current == nil {
+		return nil
+	}
+	current, err := request.Current()
+	if err != nil {
+		return err
+	}
+	if _, ok := current.Users[cmd.User]; ok && cmd.User != "" {
+		return nil
+	}
+	if _, ok := current.Groups[cmd.Group]; ok && cmd.User == "" {
+		return nil
+	}
+	if len(current.Users)+len(current.Groups) >= max {
+		return violation(this, http.StatusForbidden, problem.PolicyViolation, "resources of "+cmd.Kind+" may have at most "+strconv.Itoa(max)+" users and groups")
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/projection"
+)
+
+type ruleCase struct {
+	request  Request
+	violated bool
+}
+
+func evaluateCases(t *testing.T, rule Rule, config Config, cases map[string]ruleCase) {
+	t.Helper()
+	for name, c := range cases {
+		err := rule.Evaluate(config, c.request)
+		if !c.violated {
+			if err != nil {
+				t.Errorf("%v: expected no violation, got %v", name, err)
+			}
+			continue
+		}
+		var p problem.Problem
+		if !errors.As(err, &p) || p.Rule != rule.Id() {
+			t.Errorf("%v: expected violation of %v, got %v", name, rule.Id(), err)
+		}
+	}
+}
+
+func put(user string, group string, right string) model.PermCommandMsg {
+	return model.PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: user, Group: group, Right: right}
+}
+
+func del(user string, group string) model.PermCommandMsg {
+	return model.PermCommandMsg{Command: model.CommandDelete, Kind: "devices", Resource: "d1", User: user, Group: group}
+}
+
+func TestDeniedPrincipal(t *testing.T) {
+	config := Config{DeniedUsers: []string{"u-denied"}, DeniedGroups: []string{"g-denied"}}
+	evaluateCases(t, DeniedPrincipal{}, config, map[string]ruleCase{
+		"denied user":          {Request{UserId: "u1", Command: put("u-denied", "", "r")}, true},
+		"denied group":         {Request{UserId: "u1", Command: put("", "g-denied", "r")}, true},
+		"denied group as user": {Request{UserId: "u1", Command: put("g-denied", "", "r")}, false},
+		"other group":          {Request{UserId: "u1", Command: put("", "g1", "r")}, false},
+		"remove denied group":  {Request{UserId: "u1", Command: del("", "g-denied")}, false},
+		"empty right":          {Request{UserId: "u1", Command: put("", "g-denied", "")}, false},
+		"admin":                {Request{UserId: "u1", IsAdmin: true, Command: put("", "g-denied", "r")}, true},
+	})
+}
+
+func TestValidRights(t *testing.T) {
+	config := Config{Kinds: map[string]KindPolicy{
+		"devices":   {Rights: "rx"},
+		DefaultKind: {Rights: ""},
+	}}
+	other := put("u2", "", "rwxa")
+	other.Kind = "hubs"
+	evaluateCases(t, ValidRights{}, config, map[string]ruleCase{
+		"valid":           {Request{UserId: "u1", Command: put("u2", "", "rx")}, false},
+		"invalid":         {Request{UserId: "u1", Command: put("u2", "", "rw")}, true},
+		"unknown letter":  {Request{UserId: "u1", Command: put("u2", "", "r-")}, true},
+		"delete":          {Request{UserId: "u1", Command: del("u2", "")}, false},
+		"unrestricted":    {Request{UserId: "u1", Command: other}, false},
+		"removal by put":  {Request{UserId: "u1", Command: put("u2", "", "")}, false},
+		"admin":           {Request{UserId: "u1", IsAdmin: true, Command: put("u2", "", "a")}, true},
+		"group":           {Request{UserId: "u1", Command: put("", "g1", "w")}, true},
+		"valid for group": {Request{UserId: "u1", Command: put("", "g1", "x")}, false},
+	})
+}
+
+func TestMaxGrantees(t *testing.T) {
+	config := Config{Kinds: map[string]KindPolicy{DefaultKind: {MaxGrantees: 2}}}
+	full := func() (projection.Resource, error) {
+		return projection.Resource{Users: map[string]string{"u1": "rwxa"}, Groups: map[string]string{"g1": "r"}}, nil
+	}
+	free := func() (projection.Resource, error) {
+		return projection.Resource{Users: map[string]string{"u1": "rwxa"}}, nil
+	}
+	failing := func() (projection.Resource, error) {
+		return projection.Resource{}, errors.New("projection unavailable")
+	}
+	evaluateCases(t, MaxGrantees{}, config, map[string]ruleCase{
+		"new user":         {Request{UserId: "u1", Command: put("u2", "", "r"), Current: full}, true},
+		"new group":        {Request{UserId: "u1", Command: put("", "g2", "r"), Current: full}, true},
+		"existing user":    {Request{UserId: "u1", Command: put("u1", "", "rwxa"), Current: full}, false},
+		"existing group":   {Request{UserId: "u1", Command: put("", "g1", "rx"), Current: full}, false},
+		"group named user": {Request{UserId: "u1", Command: put("", "u1", "r"), Current: full}, true},
+		"free":             {Request{UserId: "u1", Command: put("u2", "", "r"), Current: free}, false},
+		"delete":           {Request{UserId: "u1", Command: del("u2", ""), Current: full}, false},
+		"unknown current":  {Request{UserId: "u1", Command: put("u2", "", "r")}, false},
+		"removal by put":   {Request{UserId: "u1", Command: put("u2", "", ""), Current: full}, false},
+		"admin":            {Request{UserId: "u1", IsAdmin: true, Command: put("u2", "", "r"), Current: full}, true},
+	})
+
+	err := MaxGrantees{}.Evaluate(config, Request{UserId: "u1", Command: put("u2", "", "r"), Current: failing})
+	if err == nil {
+		t.Error("expected error of Current to be returned")
+	}
+	unlimited := Config{Kinds: map[string]KindPolicy{DefaultKind: {MaxGrantees: 0}}}
+	err = MaxGrantees{}.Evaluate(unlimited, Request{UserId: "u1", Command: put("u2", "", "r"), Current: full})
+	if err != nil {
+		t.Error("expected 0 to be unlimited, got", err)
+	}
+}
+
+func TestAdministrateGrant(t *testing.T) {
+	config := Config{Kinds: map[string]KindPolicy{"devices": {AdministrateRequiresAdmin: true}}}
+	other := put("u2", "", "rwxa")
+	other.Kind = "hubs"
+	evaluateCases(t, AdministrateGrant{}, config, map[string]ruleCase{
+		"grant a":          {Request{UserId: "u1", Command: put("u2", "", "rwxa")}, true},
+		"grant a group":    {Request{UserId: "u1", Command: put("", "g1", "a")}, true},
+		"grant a as admin": {Request{UserId: "u1", IsAdmin: true, Command: put("u2", "", "rwxa")}, false},
+		"keep own a":       {Request{UserId: "u1", Command: put("u1", "", "rwxa")}, false},
+		"grant without a":  {Request{UserId: "u1", Command: put("u2", "", "rwx")}, false},
+		"delete":           {Request{UserId: "u1", Command: del("u2", "")}, false},
+		"other kind":       {Request{UserId: "u1", Command: other}, false},
+	})
+}
+
+func TestEngineReportsFirstViolation(t *testing.T) {
+	engine := New(Config{DeniedUsers: []string{"u2"}, Kinds: map[string]KindPolicy{DefaultKind: {Rights: "r"}}})
+	err := engine.Evaluate(Request{UserId: "u1", Command: put("u2", "", "rw")})
+	var p problem.Problem
+	if !errors.As(err, &p) || p.Rule != (DeniedPrincipal{}).Id() {
+		t.Error("expected violation of denied-principal, got", err)
+	}
+	err = engine.Evaluate(Request{UserId: "u1", Command: put("u3", "", "r")})
+	if err != nil {
+		t.Error("expected no violation, got", err)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/SENERGY-Platform/permission-command/lib/util"
+)
+
+const ContentType = "application/problem+json"
+
+const TypePrefix = "urn:senergy:permission-command:error:"
+
+// Code is a stable, machine-readable error identifier; clients may rely on these values for localization
+type Code string
+
+const (
+	InvalidToken          Code = "INVALID_TOKEN"
+	ValidationFailed      Code = "VALIDATION_FAILED"
+	BodyTooLarge          Code = "BODY_TOO_LARGE"
+	SelfAdminRemoval      Code = "SELF_ADMIN_REMOVAL"
+	AdminGroupProtected   Code = "ADMIN_GROUP_PROTECTED"
+	PolicyViolation       Code = "POLICY_VIOLATION"
+	NotResourceAdmin      Code = "NOT_RESOURCE_ADMIN"
+	AdminRoleRequired     Code = "ADMIN_ROLE_REQUIRED"
+	PermissionCheckFailed Code = "PERMISSION_CHECK_FAILED"
+	PublishFailed         Code = "PUBLISH_FAILED"
+	ProjectionUnavailable Code = "PROJECTION_UNAVAILABLE"
+	JobStateConflict      Code = "JOB_STATE_CONFLICT"
+	FourEyesRequired      Code = "FOUR_EYES_REQUIRED"
+	ApprovalStateConflict Code = "APPROVAL_STATE_CONFLICT"
+	UnknownTenant         Code = "UNKNOWN_TENANT"
+	TenantNotSupported    Code = "TENANT_NOT_SUPPORTED"
+	VersionMismatch       Code = "VERSION_MISMATCH"
+	IdempotencyKeyReused  Code = "IDEMPOTENCY_KEY_REUSED"
+	IdempotencyKeyInUse   Code = "IDEMPOTENCY_KEY_IN_USE"
+	NotFound              Code = "NOT_FOUND"
+	MethodNotAllowed      Code = "METHOD_NOT_ALLOWED"
+	Internal              Code = "INTERNAL_ERROR"
+)
+
+// Problem is an RFC 7807 problem details object extended by Code, RequestId and Rule
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      Code   `json:"code"`
+	RequestId string `json:"request_id,omitempty"`
+	Rule      string `json:"rule,omitempty"` //id of the violated policy rule
+	Cause     error  `json:"-"`
+}
+
+func (this Problem) Error() string {
+	if this.Detail != "" {
+		return string(this.Code) + ": " + this.Detail
+	}
+	return string(this.Code) + ": " + this.Title
+}
+
+func (this Problem) Unwrap() error {
+	return this.Cause
+}
+
+func New(status int, code Code, detail string) Problem {
+	return Problem{
+		Type:   TypePrefix + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write sends a problem+json response; the detail must never contain internal error messages
+func Write(res http.ResponseWriter, req *http.Request, status int, code Code, detail string) {
+	p := New(status, code, detail)
+	p.Instance = req.URL.Path
+	p.RequestId = util.GetRequestId(req)
+	WriteProblem(res, p)
+}
+
+// WriteBodyError answers errors of reading a request body limited by http.MaxBytesReader with 413 and others with 400
+func WriteBodyError(res http.ResponseWriter, req *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		Write(res, req, http.StatusRequestEntityTooLarge, BodyTooLarge, "request body exceeds "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+		return
+	}
+	Write(res, req, http.StatusBadRequest, ValidationFailed, "unable to read body")
+}
+
+// WriteError sends err as problem response if it is a Problem and as internal error otherwise.
+// Causes of problems are logged but never sent to the client.
+func WriteError(res http.ResponseWriter, req *http.Request, err error) {
+	var p Problem
+	if !errors.As(err, &p) {
+		WriteInternal(res, req, http.StatusInternalServerError, Internal, err)
+		return
+	}
+	WriteProblem(res, LogCause(req, p))
+}
+
+// LogCause logs the cause of p and returns p with instance and request id of req
+func LogCause(req *http.Request, p Problem) Problem {
+	if p.Cause != nil {
+		log.Println("ERROR:", util.GetRequestId(req), p.Code, p.Cause)
+	}
+	p.Instance = req.URL.Path
+	p.RequestId = util.GetRequestId(req)
+	return p
+}
+
+func WriteProblem(res http.ResponseWriter, p Problem) {
+	res.Header().Set("Content-Type", ContentType)
+	res.WriteHeader(p.Status)
+	err := json.NewEncoder(res).Encode(p)
+	if err != nil {
+		log.Println("ERROR: unable to write problem response", err)
+	}
+}
+
+// WriteInternal logs err with the request id and responds with a generic message of the given code
+func WriteInternal(res http.ResponseWriter, req *http.Request, status int, code Code, err error) {
+	log.Println("ERROR:", util.GetRequestId(req), code, err)
+	Write(res, req, status, code, http.StatusText(status))
+}
+
+// Wrap creates a problem with a generic detail, keeping err as cause for logging
+func Wrap(status int, code Code, err error) Problem {
+	p := New(status, code, http.StatusText(status))
+	p.Cause = err
+	return p
+}
+
+func NotFoundHandler() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		Write(res, req, http.StatusNotFound, NotFound, "no route for "+req.Method+" "+req.URL.Path)
+	})
+}
+
+func MethodNotAllowedHandler() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		Write(res, req, http.StatusMethodNotAllowed, MethodNotAllowed, req.Method+" is not allowed for "+req.URL.Path)
+	})
+}
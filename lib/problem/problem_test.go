@@ -0,0 +1,97 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, res *httptest.ResponseRecorder) (result Problem) {
+	t.Helper()
+	if res.Header().Get("Content-Type") != ContentType {
+		t.Error("unexpected content type", res.Header().Get("Content-Type"))
+	}
+	err := json.Unmarshal(res.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestWrite(t *testing.T) {
+	res := httptest.NewRecorder()
+	Write(res, httptest.NewRequest(http.MethodPut, "/user/u1/devices/d1/r", nil), http.StatusForbidden, NotResourceAdmin, "missing right")
+	p := decode(t, res)
+	expected := Problem{Type: TypePrefix + "NOT_RESOURCE_ADMIN", Title: "Forbidden", Status: http.StatusForbidden, Detail: "missing right", Instance: "/user/u1/devices/d1/r", Code: NotResourceAdmin}
+	if res.Code != http.StatusForbidden || p != expected {
+		t.Errorf("expected %+v, got %v %+v", expected, res.Code, p)
+	}
+}
+
+func TestWriteErrorHidesCauses(t *testing.T) {
+	cause := errors.New("dial tcp 10.0.0.1:9092: connection refused")
+	for name, err := range map[string]error{
+		"wrapped problem": Wrap(http.StatusInternalServerError, PublishFailed, cause),
+		"plain error":     cause,
+	} {
+		res := httptest.NewRecorder()
+		WriteError(res, httptest.NewRequest(http.MethodPost, "/batch", nil), err)
+		if res.Code != http.StatusInternalServerError || strings.Contains(res.Body.String(), "10.0.0.1") {
+			t.Errorf("%v: expected cause to be hidden, got %v %v", name, res.Code, res.Body.String())
+		}
+	}
+
+	p := Wrap(http.StatusBadGateway, PermissionCheckFailed, cause)
+	if !errors.Is(p, cause) {
+		t.Error("expected cause to be unwrapped")
+	}
+	res := httptest.NewRecorder()
+	WriteError(res, httptest.NewRequest(http.MethodPost, "/batch", nil), p)
+	if decode(t, res).Code != PermissionCheckFailed {
+		t.Error("expected code of problem, got", res.Body.String())
+	}
+}
+
+func TestWriteBodyError(t *testing.T) {
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader("too large"))
+	_, err := io.ReadAll(http.MaxBytesReader(res, req.Body, 4))
+	WriteBodyError(res, req, err)
+	if p := decode(t, res); res.Code != http.StatusRequestEntityTooLarge || p.Code != BodyTooLarge {
+		t.Error("expected 413, got", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	WriteBodyError(res, req, io.ErrUnexpectedEOF)
+	if p := decode(t, res); res.Code != http.StatusBadRequest || p.Code != ValidationFailed {
+		t.Error("expected 400, got", res.Code, res.Body.String())
+	}
+}
+
+func TestError(t *testing.T) {
+	if err := New(http.StatusNotFound, NotFound, "").Error(); err != "NOT_FOUND: Not Found" {
+		t.Error("unexpected message", err)
+	}
+	if err := New(http.StatusNotFound, NotFound, "no route").Error(); err != "NOT_FOUND: no route" {
+		t.Error("unexpected message", err)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type producerSettings struct {
+	RequiredAcks kafka.RequiredAcks
+	BatchSize    int
+	BatchTimeout time.Duration
+	Compression  kafka.Compression
+	WriteTimeout time.Duration
+	MaxAttempts  int
+}
+
+var requiredAcks = map[string]kafka.RequiredAcks{
+	"all":  kafka.RequireAll,
+	"one":  kafka.RequireOne,
+	"none": kafka.RequireNone,
+}
+
+var compressions = map[string]kafka.Compression{
+	"none":   0,
+	"gzip":   kafka.Gzip,
+	"snappy": kafka.Snappy,
+	"lz4":    kafka.Lz4,
+	"zstd":   kafka.Zstd,
+}
+
+// getProducerSettings validates the producer configuration
+func getProducerSettings() (result producerSettings, err error) {
+	acks, ok := requiredAcks[strings.ToLower(Config.KafkaRequiredAcks)]
+	if !ok {
+		return result, errors.New("unknown KafkaRequiredAcks " + Config.KafkaRequiredAcks + ", expected all, one or none")
+	}
+	//there is no outbox which could republish commands lost by unacknowledged writes
+	if acks == kafka.RequireNone {
+		return result, errors.New("KafkaRequiredAcks none may silently lose permission commands and is only safe with an outbox, which is not available")
+	}
+	result.RequiredAcks = acks
+	result.Compression, ok = compressions[strings.ToLower(Config.KafkaCompression)]
+	if !ok {
+		return result, errors.New("unknown KafkaCompression " + Config.KafkaCompression + ", expected none, gzip, snappy, lz4 or zstd")
+	}
+	if Config.KafkaBatchSize < 1 {
+		return result, errors.New("KafkaBatchSize must be at least 1")
+	}
+	result.BatchSize = int(Config.KafkaBatchSize)
+	if Config.KafkaMaxAttempts < 1 {
+		return result, errors.New("KafkaMaxAttempts must be at least 1")
+	}
+	result.MaxAttempts = int(Config.KafkaMaxAttempts)
+	result.BatchTimeout, err = time.ParseDuration(Config.KafkaBatchTimeout)
+	if err != nil {
+		return result, errors.New("invalid KafkaBatchTimeout: " + err.Error())
+	}
+	result.WriteTimeout, err = time.ParseDuration(Config.KafkaWriteTimeout)
+	if err != nil {
+		return result, errors.New("invalid KafkaWriteTimeout: " + err.Error())
+	}
+	//writes are synchronous, so every request waits until its batch is full or the batch timeout is reached
+	if result.BatchSize > 1 && result.BatchTimeout > time.Second {
+		return result, errors.New("KafkaBatchTimeout above 1s with KafkaBatchSize > 1 delays every request")
+	}
+	return result, nil
+}
+
+func (this producerSettings) log() {
+	log.Printf("kafka producer: acks=%v batch_size=%v batch_timeout=%v compression=%v write_timeout=%v max_attempts=%v\n",
+		this.RequiredAcks, this.BatchSize, this.BatchTimeout, strings.ToLower(Config.KafkaCompression), this.WriteTimeout, this.MaxAttempts)
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func producerConfig() *ConfigStruct {
+	return &ConfigStruct{
+		KafkaRequiredAcks: "all",
+		KafkaBatchSize:    1,
+		KafkaBatchTimeout: "10ms",
+		KafkaCompression:  "none",
+		KafkaWriteTimeout: "10s",
+		KafkaMaxAttempts:  10,
+	}
+}
+
+func TestProducerSettings(t *testing.T) {
+	old := Config
+	t.Cleanup(func() {
+		Config = old
+	})
+	Config = producerConfig()
+	Config.KafkaRequiredAcks = "One"
+	Config.KafkaCompression = "zstd"
+	settings, err := getProducerSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := producerSettings{RequiredAcks: kafka.RequireOne, BatchSize: 1, BatchTimeout: 10 * time.Millisecond, Compression: kafka.Zstd, WriteTimeout: 10 * time.Second, MaxAttempts: 10}
+	if settings != expected {
+		t.Errorf("expected %+v, got %+v", expected, settings)
+	}
+
+	invalid := map[string]func(config *ConfigStruct){
+		"unknown acks":        func(config *ConfigStruct) { config.KafkaRequiredAcks = "some" },
+		"acks none":           func(config *ConfigStruct) { config.KafkaRequiredAcks = "none" },
+		"unknown compression": func(config *ConfigStruct) { config.KafkaCompression = "brotli" },
+		"batch size":          func(config *ConfigStruct) { config.KafkaBatchSize = 0 },
+		"max attempts":        func(config *ConfigStruct) { config.KafkaMaxAttempts = 0 },
+		"batch timeout":       func(config *ConfigStruct) { config.KafkaBatchTimeout = "10" },
+		"write timeout":       func(config *ConfigStruct) { config.KafkaWriteTimeout = "" },
+		"delaying batches": func(config *ConfigStruct) {
+			config.KafkaBatchSize = 10
+			config.KafkaBatchTimeout = "2s"
+		},
+	}
+	for name, change := range invalid {
+		Config = producerConfig()
+		change(Config)
+		if _, err := getProducerSettings(); err == nil {
+			t.Errorf("%v: expected invalid configuration", name)
+		}
+	}
+
+	Config = producerConfig()
+	Config.KafkaBatchTimeout = "2s"
+	if _, err := getProducerSettings(); err != nil {
+		t.Error("expected long batch timeout to be accepted for single message batches, got", err)
+	}
+}
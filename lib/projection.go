@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/projection"
+)
+
+var localProjection *projection.Projection
+
+func getProjectionConsumerConfig(topics []string) (result projection.ConsumerConfig, err error) {
+	broker, err := GetBroker(Config.KafkaUrl)
+	if err != nil {
+		return result, err
+	}
+	dialer, err := GetKafkaDialer()
+	if err != nil {
+		return result, err
+	}
+	return projection.ConsumerConfig{
+		Brokers: broker,
+		Topics:  topics,
+		Debug:   Config.LogLevel == "DEBUG",
+		Dialer:  dialer,
+	}, nil
+}
+
+// InitProjection starts consuming the permission topic if a feature depending on the current state is configured
+func InitProjection() {
+	if !Config.ProjectionEnabled && Config.ManifestFile == "" && Config.Authorizer != AuthorizerProjection && len(Config.DelegationKinds) == 0 && !policyNeedsProjection() {
+		return
+	}
+	consumerConfig, err := getProjectionConsumerConfig(PermTopics())
+	if err != nil {
+		log.Fatal("ERROR: unable to start projection ", err)
+	}
+	localProjection = projection.New()
+	if Config.ProjectionSnapshotFile != "" {
+		err = localProjection.LoadSnapshot(Config.ProjectionSnapshotFile, PermTopics())
+		if err != nil {
+			log.Println("WARNING: unable to load projection snapshot, rebuild from topic", err)
+			localProjection = projection.New()
+		}
+	}
+	err = localProjection.Start(context.Background(), consumerConfig)
+	if err != nil {
+		log.Fatal("ERROR: unable to start projection ", err)
+	}
+	if Config.ProjectionSnapshotFile != "" {
+		interval, err := time.ParseDuration(Config.ProjectionSnapshotInterval)
+		if err != nil {
+			log.Fatal("ERROR: invalid ProjectionSnapshotInterval ", err)
+		}
+		localProjection.StartSnapshots(context.Background(), Config.ProjectionSnapshotFile, interval)
+	}
+}
+
+// policyNeedsProjection is true if a policy rule depends on the current rights of resources
+func policyNeedsProjection() bool {
+	for _, kind := range GetPolicy().Config().Kinds {
+		if kind.MaxGrantees > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// getSyncedProjection returns a problem if the projection is disabled or still reading the topic
+func getSyncedProjection() (*projection.Projection, error) {
+	if localProjection == nil {
+		return nil, problem.New(http.StatusServiceUnavailable, problem.ProjectionUnavailable, "the local permission projection is disabled")
+	}
+	if err := localProjection.Err(); err != nil {
+		return nil, problem.New(http.StatusServiceUnavailable, problem.ProjectionUnavailable, "the local permission projection failed: "+err.Error())
+	}
+	if !localProjection.Synced() {
+		return nil, problem.New(http.StatusServiceUnavailable, problem.ProjectionUnavailable, "the local permission projection is not synced yet")
+	}
+	return localProjection, nil
+}
+
+// ProjectionAuthorizer decides with the local projection instead of asking permission-search.
+// A token may administrate a resource if its user or one of its roles (groups) holds the right "a".
+type ProjectionAuthorizer struct{}
+
+func (this ProjectionAuthorizer) HasAdminRight(token auth.Token, kind string, id string) error {
+	return this.HasRights(token, kind, id, "a")
+}
+
+// HasRights checks the union of the rights of the user and its roles
+func (this ProjectionAuthorizer) HasRights(token auth.Token, kind string, id string, rights string) error {
+	err := requireDefaultTopics(token)
+	if err != nil {
+		return err
+	}
+	p, err := getSyncedProjection()
+	if err != nil {
+		return err
+	}
+	resource, _ := p.Get(kind, id)
+	held := resource.Users[token.GetUserId()]
+	for _, role := range token.RealmAccess["roles"] {
+		held += resource.Groups[role]
+	}
+	for _, right := range rights {
+		if !strings.ContainsRune(held, right) {
+			return ErrAccessDenied
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/message"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/segmentio/kafka-go"
+)
+
+type ConsumerConfig struct {
+	Brokers []string
+	Topics  []string
+	Debug   bool
+	Dialer  *kafka.Dialer //optional, defaults to kafka.DefaultDialer
+}
+
+func (this ConsumerConfig) dialer() *kafka.Dialer {
+	if this.Dialer == nil {
+		return kafka.DefaultDialer
+	}
+	return this.Dialer
+}
+
+// read errors are retried with exponential backoff between these durations
+const (
+	minReadBackoff = 100 * time.Millisecond
+	maxReadBackoff = 30 * time.Second
+)
+
+type partitionRange struct {
+	first int64
+	end   int64
+}
+
+// Start reads every partition of the topics from the beginning (or from the offsets of a loaded snapshot)
+// and applies the messages to the projection until ctx is canceled
+func (this *Projection) Start(ctx context.Context, config ConsumerConfig) error {
+	if len(config.Brokers) == 0 {
+		return errors.New("missing kafka broker")
+	}
+	conn, err := config.dialer().DialContext(ctx, "tcp", config.Brokers[0])
+	if err != nil {
+		return err
+	}
+	partitions, err := conn.ReadPartitions(config.Topics...)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	ranges := map[partitionKey]partitionRange{}
+	for _, partition := range partitions {
+		key := partitionKey{topic: partition.Topic, partition: partition.ID}
+		ranges[key], err = readRange(ctx, config.dialer(), config.Brokers[0], partition.Topic, partition.ID)
+		if err != nil {
+			return err
+		}
+		if next, known := this.nextOffset(partition.Topic, partition.ID); known && next < ranges[key].first {
+			log.Println("WARNING: projection snapshot offsets are no longer available, rebuild projection from", partition.Topic)
+			this.reset()
+		}
+	}
+	wg := sync.WaitGroup{}
+	for _, partition := range partitions {
+		key := partitionKey{topic: partition.Topic, partition: partition.ID}
+		start, known := this.nextOffset(partition.Topic, partition.ID)
+		if !known {
+			start = ranges[key].first
+		}
+		wg.Add(1)
+		go this.consume(ctx, config, partition.Topic, partition.ID, start, ranges[key].end, wg.Done)
+	}
+	go func() {
+		wg.Wait()
+		if err := this.Err(); err != nil {
+			log.Println("ERROR: projection of", config.Topics, "is not synced:", err)
+			return
+		}
+		log.Println("projection synced with", config.Topics)
+		this.markSynced()
+	}()
+	return nil
+}
+
+func readRange(ctx context.Context, dialer *kafka.Dialer, broker string, topic string, partition int) (result partitionRange, err error) {
+	conn, err := dialer.DialLeader(ctx, "tcp", broker, topic, partition)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	result.first, result.end, err = conn.ReadOffsets()
+	return result, err
+}
+
+// consume calls synced once the partition has been read up to end.
+// If it stops before, the projection is marked as failed and synced is called to release Start.
+func (this *Projection) consume(ctx context.Context, config ConsumerConfig, topic string, partition int, start int64, end int64, synced func()) {
+	var logger kafka.Logger
+	if config.Debug {
+		logger = log.New(os.Stdout, "[KAFKA-PROJECTION] ", 0)
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   config.Brokers,
+		Topic:     topic,
+		Partition: partition,
+		MaxBytes:  1e6,
+		Logger:    logger,
+		Dialer:    config.dialer(),
+	})
+	defer reader.Close()
+	syncOnce := sync.Once{}
+	defer syncOnce.Do(func() {
+		this.fail(fmt.Errorf("consumer of %v partition %v stopped before reading up to offset %v", topic, partition, end))
+		synced()
+	})
+	err := reader.SetOffset(start)
+	if err != nil {
+		log.Println("ERROR: unable to set projection offset", err)
+		return
+	}
+	this.setLag(topic, partition, end-start)
+	if start >= end {
+		syncOnce.Do(synced)
+	}
+	backoff := minReadBackoff
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return
+			}
+			log.Println("ERROR: while consuming permission topic", topic, partition, err, "retry in", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxReadBackoff)
+			continue
+		}
+		backoff = minReadBackoff
+		cmd, err := message.Decode(msg.Value, contentType(msg))
+		if err != nil {
+			log.Println("WARNING: ignore invalid permission command", topic, msg.Partition, msg.Offset, err)
+			cmd = model.PermCommandMsg{}
+		}
+		this.Apply(topic, partition, msg.Offset, cmd)
+		this.setLag(topic, partition, reader.Lag())
+		if msg.Offset+1 >= end {
+			syncOnce.Do(synced)
+		}
+	}
+}
+
+func contentType(msg kafka.Message) string {
+	for _, header := range msg.Headers {
+		if header.Key == message.HeaderContentType {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,318 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package projection
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+// Resource holds the current rights of a resource, mapping user ids and group names to normalized rights
+type Resource struct {
+	Users    map[string]string `json:"users"`
+	Groups   map[string]string `json:"groups"`
+	Versions map[string]int64  `json:"versions,omitempty"` //"topic:partition" -> offset of the last command applied to the resource
+}
+
+// UnknownVersion is the version of resources that never had rights
+const UnknownVersion = "0"
+
+// Version changes with every command applied to the resource. Commands of a resource may be spread over partitions
+// (the message key contains user and group), so it joins the last offset of every partition.
+func (this Resource) Version() string {
+	if len(this.Versions) == 0 {
+		return UnknownVersion
+	}
+	parts := []string{}
+	for _, key := range sortedKeys(this.Versions) {
+		parts = append(parts, key+":"+strconv.FormatInt(this.Versions[key], 10))
+	}
+	return strings.Join(parts, "/")
+}
+
+// Projection is the in-memory state of all permission commands read from the permission topics
+type Projection struct {
+	mux        sync.RWMutex
+	resources  map[string]map[string]*Resource
+	partitions map[partitionKey]*partitionState
+	synced     chan struct{}
+	syncOnce   sync.Once
+	failed     chan struct{}
+	failOnce   sync.Once
+	failure    error
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+type partitionState struct {
+	next int64 //offset of the next message to apply
+	lag  int64
+}
+
+type Status struct {
+	Synced     bool              `json:"synced"`
+	Error      string            `json:"error,omitempty"`
+	Lag        int64             `json:"lag"`
+	Partitions []PartitionStatus `json:"partitions"`
+}
+
+type PartitionStatus struct {
+	Topic      string `json:"topic"`
+	Partition  int    `json:"partition"`
+	NextOffset int64  `json:"next_offset"`
+	Lag        int64  `json:"lag"`
+}
+
+func New() *Projection {
+	return &Projection{
+		resources:  map[string]map[string]*Resource{},
+		partitions: map[partitionKey]*partitionState{},
+		synced:     make(chan struct{}),
+		failed:     make(chan struct{}),
+	}
+}
+
+// Apply updates the state with the permission command read at offset of the topic partition
+func (this *Projection) Apply(topic string, partition int, offset int64, cmd model.PermCommandMsg) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.partition(topic, partition).next = offset + 1
+	resource := this.apply(cmd)
+	if resource != nil {
+		if resource.Versions == nil {
+			resource.Versions = map[string]int64{}
+		}
+		resource.Versions[topic+":"+strconv.Itoa(partition)] = offset
+	}
+}
+
+// apply mirrors the handling of permission-search: PUT sets the right (an empty right removes the principal),
+// DELETE removes the principal, other commands are ignored; User takes precedence over Group.
+// It returns the changed resource or nil if the command was ignored.
+func (this *Projection) apply(cmd model.PermCommandMsg) *Resource {
+	var right string
+	switch cmd.Command {
+	case model.CommandPut:
+		right = model.NormalizeRight(cmd.Right)
+	case model.CommandDelete:
+		right = ""
+	default:
+		return nil
+	}
+	if cmd.User == "" && cmd.Group == "" {
+		return nil
+	}
+	kind, ok := this.resources[cmd.Kind]
+	if !ok {
+		kind = map[string]*Resource{}
+		this.resources[cmd.Kind] = kind
+	}
+	resource, ok := kind[cmd.Resource]
+	if !ok {
+		resource = &Resource{Users: map[string]string{}, Groups: map[string]string{}}
+		kind[cmd.Resource] = resource
+	}
+	if cmd.User != "" {
+		set(resource.Users, cmd.User, right)
+	} else {
+		set(resource.Groups, cmd.Group, right)
+	}
+	return resource
+}
+
+// hasRights is false for resources whose last principal was removed; they are kept with their versions,
+// so that a recreated resource never gets a version it had before
+func (this *Resource) hasRights() bool {
+	return len(this.Users) > 0 || len(this.Groups) > 0
+}
+
+func set(m map[string]string, key string, right string) {
+	if right == "" {
+		delete(m, key)
+	} else {
+		m[key] = right
+	}
+}
+
+func (this *Projection) partition(topic string, partition int) *partitionState {
+	key := partitionKey{topic: topic, partition: partition}
+	state, ok := this.partitions[key]
+	if !ok {
+		state = &partitionState{}
+		this.partitions[key] = state
+	}
+	return state
+}
+
+// Get returns a copy of the rights of the resource and false if no rights are known; the version of a resource whose
+// rights were removed is kept
+func (this *Projection) Get(kind string, id string) (result Resource, found bool) {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	resource, ok := this.resources[kind][id]
+	if !ok {
+		return Resource{Users: map[string]string{}, Groups: map[string]string{}}, false
+	}
+	return resource.copy(), resource.hasRights()
+}
+
+// Grants returns a PUT command for every current right, sorted by kind, resource, users and groups
+func (this *Projection) Grants() (result []model.Command) {
+	result, _ = this.GrantsWithVersions()
+	return result
+}
+
+// GrantsWithVersions returns Grants and the Version of every resource with rights (kind -> id -> version), read at the same time
+func (this *Projection) GrantsWithVersions() (result []model.Command, versions map[string]map[string]string) {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	versions = map[string]map[string]string{}
+	for _, kind := range sortedKeys(this.resources) {
+		resources := this.resources[kind]
+		versions[kind] = map[string]string{}
+		for _, id := range sortedKeys(resources) {
+			resource := resources[id]
+			if !resource.hasRights() {
+				continue
+			}
+			versions[kind][id] = resource.Version()
+			for _, user := range sortedKeys(resource.Users) {
+				result = append(result, model.Command{Command: model.CommandPut, Kind: kind, Resource: id, User: user, Right: resource.Users[user]})
+			}
+			for _, group := range sortedKeys(resource.Groups) {
+				result = append(result, model.Command{Command: model.CommandPut, Kind: kind, Resource: id, Group: group, Right: resource.Groups[group]})
+			}
+		}
+	}
+	return result, versions
+}
+
+func sortedKeys[T any](m map[string]T) (result []string) {
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (this *Resource) copy() Resource {
+	result := Resource{Users: map[string]string{}, Groups: map[string]string{}}
+	for key, value := range this.Users {
+		result.Users[key] = value
+	}
+	for key, value := range this.Groups {
+		result.Groups[key] = value
+	}
+	if this.Versions != nil {
+		result.Versions = map[string]int64{}
+		for key, value := range this.Versions {
+			result.Versions[key] = value
+		}
+	}
+	return result
+}
+
+func (this *Projection) setLag(topic string, partition int, lag int64) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.partition(topic, partition).lag = lag
+}
+
+func (this *Projection) nextOffset(topic string, partition int) (offset int64, known bool) {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	state, ok := this.partitions[partitionKey{topic: topic, partition: partition}]
+	if !ok {
+		return 0, false
+	}
+	return state.next, true
+}
+
+func (this *Projection) Status() (result Status) {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	result.Synced = this.Synced()
+	if err := this.Err(); err != nil {
+		result.Error = err.Error()
+	}
+	result.Partitions = []PartitionStatus{}
+	for key, state := range this.partitions {
+		result.Lag += state.lag
+		result.Partitions = append(result.Partitions, PartitionStatus{Topic: key.topic, Partition: key.partition, NextOffset: state.next, Lag: state.lag})
+	}
+	sort.Slice(result.Partitions, func(i, j int) bool {
+		if result.Partitions[i].Topic != result.Partitions[j].Topic {
+			return result.Partitions[i].Topic < result.Partitions[j].Topic
+		}
+		return result.Partitions[i].Partition < result.Partitions[j].Partition
+	})
+	return result
+}
+
+func (this *Projection) markSynced() {
+	this.syncOnce.Do(func() {
+		close(this.synced)
+	})
+}
+
+// Synced is true once all messages which existed when the consumer started have been applied
+func (this *Projection) Synced() bool {
+	select {
+	case <-this.synced:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail records the first reason why the projection can not become synced
+func (this *Projection) fail(err error) {
+	this.failOnce.Do(func() {
+		this.failure = err
+		close(this.failed)
+	})
+}
+
+// Err returns why the projection can not become synced, e.g. because a partition consumer stopped
+func (this *Projection) Err() error {
+	select {
+	case <-this.failed:
+		return this.failure
+	default:
+		return nil
+	}
+}
+
+// WaitForSync returns nil once the projection is synced or the reason why it never will be
+func (this *Projection) WaitForSync(ctx context.Context) error {
+	select {
+	case <-this.synced:
+		return nil
+	case <-this.failed:
+		return this.failure
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package projection
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+func TestVersionChangesOnDeleteAndRecreate(t *testing.T) {
+	p := New()
+	p.Apply("permissions", 0, 10, model.PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u1", Right: "rx"})
+	_, versions := p.GrantsWithVersions()
+	replayed := versions["devices"]["d1"]
+	if replayed == UnknownVersion {
+		t.Fatal("expected known version")
+	}
+
+	p.Apply("permissions", 0, 11, model.PermCommandMsg{Command: model.CommandDelete, Kind: "devices", Resource: "d1", User: "u1"})
+	current, found := p.Get("devices", "d1")
+	if found || current.Version() == replayed || current.Version() == UnknownVersion {
+		t.Fatal("expected changed version after delete, got", current.Version())
+	}
+	deleted := current.Version()
+	if grants, _ := p.GrantsWithVersions(); len(grants) != 0 {
+		t.Fatal("expected no grants of deleted resource, got", grants)
+	}
+
+	p.Apply("permissions", 0, 12, model.PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u1", Right: "rx"})
+	current, _ = p.Get("devices", "d1")
+	if current.Version() == replayed || current.Version() == deleted {
+		t.Fatal("expected changed version after recreate, got", current.Version())
+	}
+}
+
+func TestFailedProjectionIsNotSynced(t *testing.T) {
+	p := New()
+	p.fail(errors.New("consumer stopped"))
+	p.fail(errors.New("second failure"))
+	err := p.WaitForSync(context.Background())
+	if err == nil || err.Error() != "consumer stopped" {
+		t.Fatal("expected the first failure, got", err)
+	}
+	status := p.Status()
+	if status.Synced || status.Error != "consumer stopped" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
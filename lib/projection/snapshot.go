@@ -0,0 +1,120 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package projection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/jsonfile"
+)
+
+type snapshot struct {
+	Topic        string                          `json:"topic,omitempty"`   //snapshots of a single topic, before topic routing
+	Offsets      map[int]int64                   `json:"offsets,omitempty"` //offsets of Topic
+	TopicOffsets map[string]map[int]int64        `json:"topic_offsets"`
+	Resources    map[string]map[string]*Resource `json:"resources"`
+}
+
+// LoadSnapshot restores a state written by SaveSnapshot; consuming continues after the stored offsets.
+// A missing file or a snapshot containing other topics than the given ones is ignored.
+func (this *Projection) LoadSnapshot(location string, topics []string) error {
+	file, err := os.Open(location)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	s := snapshot{}
+	err = json.NewDecoder(file).Decode(&s)
+	if err != nil {
+		return err
+	}
+	if s.Topic != "" {
+		s.TopicOffsets = map[string]map[int]int64{s.Topic: s.Offsets}
+	}
+	for topic := range s.TopicOffsets {
+		if !slices.Contains(topics, topic) {
+			log.Println("WARNING: ignore projection snapshot containing topic", topic)
+			return nil
+		}
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if s.Resources != nil {
+		this.resources = s.Resources
+	}
+	for topic, offsets := range s.TopicOffsets {
+		for partition, offset := range offsets {
+			this.partition(topic, partition).next = offset
+		}
+	}
+	return nil
+}
+
+// SaveSnapshot atomically writes the current state and offsets to location
+func (this *Projection) SaveSnapshot(location string) error {
+	this.mux.RLock()
+	defer this.mux.RUnlock()
+	s := snapshot{TopicOffsets: map[string]map[int]int64{}, Resources: this.resources}
+	for key, state := range this.partitions {
+		if s.TopicOffsets[key.topic] == nil {
+			s.TopicOffsets[key.topic] = map[int]int64{}
+		}
+		s.TopicOffsets[key.topic][key.partition] = state.next
+	}
+	return jsonfile.Write(location, s)
+}
+
+// reset drops the state, used if the stored offsets are no longer available in the topic
+func (this *Projection) reset() {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.resources = map[string]map[string]*Resource{}
+	this.partitions = map[partitionKey]*partitionState{}
+}
+
+// StartSnapshots saves the state every interval and once more when ctx is done
+func (this *Projection) StartSnapshots(ctx context.Context, location string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				err := this.SaveSnapshot(location)
+				if err != nil {
+					log.Println("ERROR: unable to save projection snapshot", err)
+				}
+				return
+			case <-ticker.C:
+				err := this.SaveSnapshot(location)
+				if err != nil {
+					log.Println("ERROR: unable to save projection snapshot", err)
+				}
+			}
+		}
+	}()
+}
@@ -2,8 +2,9 @@ package lib
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"github.com/SENERGY-Platform/permission-command/lib/kafkaauth"
+	"github.com/SENERGY-Platform/permission-command/lib/message"
 	"github.com/segmentio/kafka-go"
 	"io/ioutil"
 	"log"
@@ -14,12 +15,25 @@ import (
 	"time"
 )
 
+// Publisher writes permission commands to the topic of their resource kind, see TopicOfKind
 type Publisher struct {
-	writer *kafka.Writer
+	writers map[string]*kafka.Writer
 }
 
 func NewPublisher() (*Publisher, error) {
-	err := InitTopic(Config.KafkaUrl, Config.PermTopic)
+	settings, err := getProducerSettings()
+	if err != nil {
+		return nil, err
+	}
+	settings.log()
+	if _, err = message.ContentType(Config.MessageEncoding); err != nil {
+		return nil, err
+	}
+	if Config.MessageEncoding != message.EncodingJson {
+		log.Println("WARNING: MessageEncoding", Config.MessageEncoding, "can not be decoded by consumers expecting json, e.g. permission-search")
+	}
+	topics := allPermTopics()
+	err = InitTopic(Config.KafkaUrl, topics...)
 	if err != nil {
 		return nil, err
 	}
@@ -30,24 +44,55 @@ func NewPublisher() (*Publisher, error) {
 	if len(broker) == 0 {
 		return nil, errors.New("missing kafka broker")
 	}
-	writer, err := GetKafkaWriter(broker, Config.PermTopic, Config.LogLevel == "DEBUG")
-	if err != nil {
-		return nil, err
+	publisher := &Publisher{writers: map[string]*kafka.Writer{}}
+	for _, topic := range topics {
+		publisher.writers[topic], err = GetKafkaWriter(broker, topic, settings, Config.LogLevel == "DEBUG")
+		if err != nil {
+			return nil, err
+		}
 	}
-	return &Publisher{writer: writer}, nil
+	return publisher, nil
 }
 
 func (this *Publisher) Publish(command PermCommandMsg) (err error) {
-	message, err := json.Marshal(command)
+	return this.PublishWithContext(context.Background(), command)
+}
+
+func (this *Publisher) PublishWithContext(ctx context.Context, command PermCommandMsg) (err error) {
+	return this.PublishTo(ctx, TopicOfKind(command.Kind), command)
+}
+
+// PublishTo writes the command to topic, which has to be one of the topics of allPermTopics
+func (this *Publisher) PublishTo(ctx context.Context, topic string, command PermCommandMsg) (err error) {
+	writer, ok := this.writers[topic]
+	if !ok {
+		return errors.New("no writer for topic " + topic)
+	}
+	value, headers, err := message.Encode(command, Config.MessageEncoding)
 	if err != nil {
 		return err
 	}
-	err = this.writer.WriteMessages(
-		context.Background(),
+	now := time.Now()
+	if Config.CloudEventsEnabled {
+		ceHeaders, err := message.CloudEventHeaders(command, Config.CloudEventsSource, now)
+		if err != nil {
+			return err
+		}
+		for key, value := range ceHeaders {
+			headers[key] = value
+		}
+	}
+	kafkaHeaders := []kafka.Header{}
+	for _, key := range sortedKeys(headers) {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: key, Value: []byte(headers[key])})
+	}
+	err = writer.WriteMessages(
+		ctx,
 		kafka.Message{
-			Key:   []byte(command.Resource + "_" + command.User + "_" + command.Group),
-			Value: message,
-			Time:  time.Now(),
+			Key:     []byte(command.Resource + "_" + command.User + "_" + command.Group),
+			Value:   value,
+			Headers: kafkaHeaders,
+			Time:    now,
 		},
 	)
 	if err != nil {
@@ -56,21 +101,37 @@ func (this *Publisher) Publish(command PermCommandMsg) (err error) {
 	return err
 }
 
-func GetKafkaWriter(broker []string, topic string, debug bool) (writer *kafka.Writer, err error) {
+func (this *Publisher) Close() (err error) {
+	for _, writer := range this.writers {
+		err = errors.Join(err, writer.Close())
+	}
+	return err
+}
+
+func GetKafkaWriter(broker []string, topic string, settings producerSettings, debug bool) (writer *kafka.Writer, err error) {
 	var logger *log.Logger
 	if debug {
 		logger = log.New(os.Stdout, "[KAFKA-PRODUCER] ", 0)
 	} else {
 		logger = log.New(ioutil.Discard, "", 0)
 	}
+	transport, err := kafkaSecurity().Transport()
+	if err != nil {
+		return nil, err
+	}
 	writer = &kafka.Writer{
-		Addr:        kafka.TCP(broker...),
-		Topic:       topic,
-		MaxAttempts: 10,
-		Logger:      logger,
-		Async:       false,
-		BatchSize:   1,
-		Balancer:    &kafka.Hash{},
+		Addr:         kafka.TCP(broker...),
+		Topic:        topic,
+		MaxAttempts:  settings.MaxAttempts,
+		Logger:       logger,
+		Async:        false,
+		BatchSize:    settings.BatchSize,
+		BatchTimeout: settings.BatchTimeout,
+		WriteTimeout: settings.WriteTimeout,
+		RequiredAcks: settings.RequiredAcks,
+		Compression:  settings.Compression,
+		Balancer:     &kafka.Hash{},
+		Transport:    transport,
 	}
 	return writer, err
 }
@@ -79,8 +140,30 @@ func GetBroker(bootstrapUrl string) (brokers []string, err error) {
 	return getBroker(bootstrapUrl)
 }
 
+// kafkaSecurity returns the tls and sasl settings of Config
+func kafkaSecurity() kafkaauth.Config {
+	return kafkaauth.Config{
+		TlsEnabled:            Config.KafkaTlsEnabled,
+		TlsCaFile:             Config.KafkaTlsCaFile,
+		TlsCertFile:           Config.KafkaTlsCertFile,
+		TlsKeyFile:            Config.KafkaTlsKeyFile,
+		TlsInsecureSkipVerify: Config.KafkaTlsInsecureSkipVerify,
+		SaslMechanism:         Config.KafkaSaslMechanism,
+		SaslUsername:          Config.KafkaSaslUsername,
+		SaslPassword:          Config.KafkaSaslPassword,
+	}
+}
+
+func GetKafkaDialer() (*kafka.Dialer, error) {
+	return kafkaSecurity().Dialer()
+}
+
 func getBroker(bootstrapUrl string) (result []string, err error) {
-	conn, err := kafka.Dial("tcp", bootstrapUrl)
+	dialer, err := GetKafkaDialer()
+	if err != nil {
+		return result, err
+	}
+	conn, err := dialer.Dial("tcp", bootstrapUrl)
 	if err != nil {
 		return result, err
 	}
@@ -94,60 +177,3 @@ func getBroker(bootstrapUrl string) (result []string, err error) {
 	}
 	return result, nil
 }
-
-func InitTopic(bootstrapUrl string, topics ...string) (err error) {
-	conn, err := kafka.Dial("tcp", bootstrapUrl)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
-	controller, err := conn.Controller()
-	if err != nil {
-		return err
-	}
-	var controllerConn *kafka.Conn
-	controllerConn, err = kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
-	if err != nil {
-		return err
-	}
-	defer controllerConn.Close()
-
-	topicConfigs := []kafka.TopicConfig{}
-
-	for _, topic := range topics {
-		topicConfigs = append(topicConfigs, kafka.TopicConfig{
-			Topic:             topic,
-			NumPartitions:     1,
-			ReplicationFactor: 1,
-			ConfigEntries: []kafka.ConfigEntry{
-				{
-					ConfigName:  "retention.ms",
-					ConfigValue: "-1",
-				},
-				{
-					ConfigName:  "retention.bytes",
-					ConfigValue: "-1",
-				},
-				{
-					ConfigName:  "cleanup.policy",
-					ConfigValue: "compact",
-				},
-				{
-					ConfigName:  "delete.retention.ms",
-					ConfigValue: "86400000",
-				},
-				{
-					ConfigName:  "segment.ms",
-					ConfigValue: "604800000",
-				},
-				{
-					ConfigName:  "min.cleanable.dirty.ratio",
-					ConfigValue: "0.1",
-				},
-			},
-		})
-	}
-
-	return controllerConn.CreateTopics(topicConfigs...)
-}
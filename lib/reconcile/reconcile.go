@@ -0,0 +1,197 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package reconcile compares the rights expected from the permission topic with the state of permission-search
+package reconcile
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/permsearch"
+)
+
+const (
+	// FindingMissing is an expected right permission-search does not know
+	FindingMissing = "missing"
+	// FindingDivergent is a right which differs between the topic and permission-search
+	FindingDivergent = "divergent"
+	// FindingUnexpected is a right of permission-search without command in the topic, e.g. set by resource creation
+	FindingUnexpected = "unexpected"
+	// FindingResourceMissing is a resource of the topic which permission-search does not know
+	FindingResourceMissing = "resource_missing"
+	FindingError           = "error"
+)
+
+type Report struct {
+	Tenant     string    `json:"tenant,omitempty"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	Resources  int       `json:"resources"`
+	Consistent int       `json:"consistent"`
+	Repaired   int       `json:"repaired"`
+	Skipped    int       `json:"skipped"`
+	Findings   []Finding `json:"findings"`
+}
+
+type Finding struct {
+	Type     string `json:"type"`
+	Kind     string `json:"kind"`
+	Resource string `json:"resource"`
+	User     string `json:"user,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Repaired bool   `json:"repaired,omitempty"`
+	Skipped  bool   `json:"skipped,omitempty"`
+}
+
+// ErrChanged is returned by Repair if the resource changed since the replay; the finding is skipped
+var ErrChanged = errors.New("resource changed since the replay")
+
+// Fetch returns the rights permission-search knows for a resource
+type Fetch func(kind string, resource string) (permsearch.ResourceRights, error)
+
+// Repair republishes an expected right
+type Repair func(command model.Command) error
+
+// Run compares the expected grants (PUT commands as returned by a replay of the topic) with permission-search.
+// If repair is not nil, missing and divergent rights are republished; unexpected rights are only reported.
+// Repair is called per finding and may return ErrChanged to skip findings outdated by newer commands.
+func Run(expected []model.Command, fetch Fetch, repair Repair) (report Report) {
+	report.Started = time.Now()
+	report.Findings = []Finding{}
+	for _, resource := range group(expected) {
+		report.Resources++
+		actual, err := fetch(resource.kind, resource.id)
+		if errors.Is(err, permsearch.ErrNotFound) {
+			report.Findings = append(report.Findings, Finding{Type: FindingResourceMissing, Kind: resource.kind, Resource: resource.id})
+			continue
+		}
+		if err != nil {
+			report.Findings = append(report.Findings, Finding{Type: FindingError, Kind: resource.kind, Resource: resource.id, Error: err.Error()})
+			continue
+		}
+		findings := compare(resource, actual)
+		if len(findings) == 0 {
+			report.Consistent++
+			continue
+		}
+		for _, finding := range findings {
+			if repair != nil && (finding.Type == FindingMissing || finding.Type == FindingDivergent) {
+				err = repair(model.Command{
+					Command:  model.CommandPut,
+					Kind:     finding.Kind,
+					Resource: finding.Resource,
+					User:     finding.User,
+					Group:    finding.Group,
+					Right:    finding.Expected,
+				})
+				switch {
+				case errors.Is(err, ErrChanged):
+					finding.Skipped = true
+					report.Skipped++
+				case err != nil:
+					finding.Error = err.Error()
+				default:
+					finding.Repaired = true
+					report.Repaired++
+				}
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+	report.Finished = time.Now()
+	return report
+}
+
+type expectedResource struct {
+	kind   string
+	id     string
+	users  map[string]string
+	groups map[string]string
+}
+
+func group(expected []model.Command) (result []*expectedResource) {
+	index := map[string]*expectedResource{}
+	for _, command := range expected {
+		key := command.Kind + "/" + command.Resource
+		resource, ok := index[key]
+		if !ok {
+			resource = &expectedResource{kind: command.Kind, id: command.Resource, users: map[string]string{}, groups: map[string]string{}}
+			index[key] = resource
+			result = append(result, resource)
+		}
+		if command.User != "" {
+			resource.users[command.User] = model.NormalizeRight(command.Right)
+		} else {
+			resource.groups[command.Group] = model.NormalizeRight(command.Right)
+		}
+	}
+	return result
+}
+
+func compare(expected *expectedResource, actual permsearch.ResourceRights) (result []Finding) {
+	actualUsers := map[string]string{}
+	for user, right := range actual.UserRights {
+		actualUsers[user] = right.String()
+	}
+	actualGroups := map[string]string{}
+	for group, right := range actual.GroupRights {
+		actualGroups[group] = right.String()
+	}
+	result = append(result, compareRights(expected, expected.users, actualUsers, func(f *Finding, name string) { f.User = name })...)
+	result = append(result, compareRights(expected, expected.groups, actualGroups, func(f *Finding, name string) { f.Group = name })...)
+	return result
+}
+
+func compareRights(resource *expectedResource, expected map[string]string, actual map[string]string, setPrincipal func(f *Finding, name string)) (result []Finding) {
+	for _, name := range sortedKeys(expected) {
+		finding := Finding{Kind: resource.kind, Resource: resource.id, Expected: expected[name]}
+		setPrincipal(&finding, name)
+		actualRight, ok := actual[name]
+		switch {
+		case !ok || actualRight == "":
+			finding.Type = FindingMissing
+		case actualRight != expected[name]:
+			finding.Type = FindingDivergent
+			finding.Actual = actualRight
+		default:
+			continue
+		}
+		result = append(result, finding)
+	}
+	for _, name := range sortedKeys(actual) {
+		if _, ok := expected[name]; ok || actual[name] == "" {
+			continue
+		}
+		finding := Finding{Type: FindingUnexpected, Kind: resource.kind, Resource: resource.id, Actual: actual[name]}
+		setPrincipal(&finding, name)
+		result = append(result, finding)
+	}
+	return result
+}
+
+func sortedKeys(m map[string]string) (result []string) {
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reconcile
+
+import (
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/permsearch"
+)
+
+func TestRunSkipsChangedResources(t *testing.T) {
+	expected := []model.Command{
+		{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u1", Right: "rx"},
+		{Command: model.CommandPut, Kind: "devices", Resource: "d2", User: "u1", Right: "rx"},
+	}
+	fetch := func(kind string, resource string) (permsearch.ResourceRights, error) {
+		return permsearch.ResourceRights{}, nil
+	}
+	repaired := []string{}
+	repair := func(command model.Command) error {
+		if command.Resource == "d2" {
+			return ErrChanged
+		}
+		repaired = append(repaired, command.Resource)
+		return nil
+	}
+	report := Run(expected, fetch, repair)
+	if report.Repaired != 1 || report.Skipped != 1 || len(repaired) != 1 || repaired[0] != "d1" {
+		t.Fatalf("expected d1 repaired and d2 skipped, got %+v", report)
+	}
+	for _, finding := range report.Findings {
+		if finding.Type != FindingMissing || finding.Repaired != (finding.Resource == "d1") || finding.Skipped != (finding.Resource == "d2") || finding.Error != "" {
+			t.Errorf("unexpected finding %+v", finding)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/permsearch"
+	"github.com/SENERGY-Platform/permission-command/lib/reconcile"
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
+)
+
+var serviceCredentials *auth.ClientCredentials
+var serviceCredentialsOnce sync.Once
+
+// GetServiceToken returns a token of the service account configured by AuthTokenUrl, AuthClientId and AuthClientSecret
+func GetServiceToken() (string, error) {
+	serviceCredentialsOnce.Do(func() {
+		serviceCredentials = auth.NewClientCredentials(Config.AuthTokenUrl, Config.AuthClientId, Config.AuthClientSecret)
+	})
+	return serviceCredentials.Token()
+}
+
+var lastReconciliations = map[string]*reconcile.Report{} //tenant name -> last report
+var lastReconciliationMux sync.RWMutex
+
+// RunReconciliation compares a replay of the permission topics of the tenant with its permission-search and,
+// with repair, republishes missing and divergent rights
+func RunReconciliation(ctx context.Context, t tenant.Tenant, repair bool) (report reconcile.Report, err error) {
+	permissionsViewUrl := getPermissionsViewUrl(t)
+	if permissionsViewUrl == "" {
+		return report, errors.New("reconciliation needs PermissionsViewUrl")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replayed, err := replay(ctx, t)
+	if err != nil {
+		return report, err
+	}
+	expected, versions := replayed.GrantsWithVersions()
+	search := permsearch.New(permissionsViewUrl)
+	fetch := func(kind string, resource string) (permsearch.ResourceRights, error) {
+		token, err := GetServiceToken()
+		if err != nil {
+			return permsearch.ResourceRights{}, err
+		}
+		return search.GetRights(token, kind, resource)
+	}
+	var repairFunc reconcile.Repair
+	if repair {
+		repairFunc = func(command model.Command) error {
+			//the projection keeps consuming, commands published since the replay (e.g. a DELETE) must not be undone
+			current, _ := replayed.Get(command.Kind, command.Resource)
+			if current.Version() != versions[command.Kind][command.Resource] {
+				return reconcile.ErrChanged
+			}
+			return sendTenantEvent(t, CommandFromModel(command))
+		}
+	}
+	report = reconcile.Run(expected, fetch, repairFunc)
+	report.Tenant = t.Name
+	lastReconciliationMux.Lock()
+	lastReconciliations[t.Name] = &report
+	lastReconciliationMux.Unlock()
+	if Config.ReconcileReportFile != "" {
+		err = writeReport(reportFileOf(t), report)
+		if err != nil {
+			log.Println("ERROR: unable to write reconciliation report", err)
+		}
+	}
+	return report, nil
+}
+
+func GetLastReconciliation(t tenant.Tenant) *reconcile.Report {
+	lastReconciliationMux.RLock()
+	defer lastReconciliationMux.RUnlock()
+	return lastReconciliations[t.Name]
+}
+
+// reportFileOf inserts the tenant name before the extension of Config.ReconcileReportFile, e.g. report.customer.json
+func reportFileOf(t tenant.Tenant) string {
+	if t.Name == "" {
+		return Config.ReconcileReportFile
+	}
+	ext := filepath.Ext(Config.ReconcileReportFile)
+	return strings.TrimSuffix(Config.ReconcileReportFile, ext) + "." + t.Name + ext
+}
+
+// StartReconciliationJob runs the reconciliation of every tenant every Config.ReconcileInterval
+func StartReconciliationJob(ctx context.Context) {
+	if Config.ReconcileInterval == "" {
+		return
+	}
+	interval, err := time.ParseDuration(Config.ReconcileInterval)
+	if err != nil {
+		log.Fatal("ERROR: invalid ReconcileInterval ", err)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, t := range listTenants() {
+					report, err := RunReconciliation(ctx, t, Config.ReconcileRepair)
+					if err != nil {
+						log.Println("ERROR: reconciliation failed", t.Name, err)
+						continue
+					}
+					log.Println("reconciliation finished:", t.Name, report.Resources, "resources,", len(report.Findings), "findings,", report.Repaired, "repaired,", report.Skipped, "skipped")
+				}
+			}
+		}
+	}()
+}
+
+// RunReconcileCommand implements the one-shot 'reconcile' subcommand of the service binary
+func RunReconcileCommand(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "republish missing and divergent rights")
+	out := fs.String("out", "", "report file (default stdout)")
+	tenantName := fs.String("tenant", "", "tenant to reconcile, required if Tenants are configured")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	t, err := getTenantByName(*tenantName)
+	if err != nil {
+		return err
+	}
+	if *repair {
+		InitEventConn()
+		defer StopEventConn()
+	}
+	report, err := RunReconciliation(context.Background(), t, *repair)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		return writeReport(*out, report)
+	}
+	return encodeReport(os.Stdout, report)
+}
+
+func writeReport(location string, report reconcile.Report) error {
+	file, err := os.Create(location)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return encodeReport(file, report)
+}
+
+func encodeReport(out io.Writer, report reconcile.Report) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
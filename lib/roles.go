@@ -0,0 +1,100 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/roles"
+)
+
+// GetRoles returns Config.Roles or, if not configured, roles.DefaultConfig
+func GetRoles() roles.Config {
+	rolesOnce.Do(func() {
+		rolesConfig = roles.DefaultConfig()
+		if Config != nil && Config.Roles != nil {
+			rolesConfig = Config.Roles
+		}
+		err := rolesConfig.Validate()
+		if err != nil {
+			log.Fatal("ERROR: invalid Roles ", err)
+		}
+	})
+	return rolesConfig
+}
+
+var rolesConfig roles.Config
+var rolesOnce sync.Once
+
+// expandRole replaces a role name in the right of PUT commands by its right string
+func expandRole(cmd PermCommandMsg) (PermCommandMsg, error) {
+	if cmd.Command != model.CommandPut {
+		return cmd, nil
+	}
+	right, err := GetRoles().Expand(cmd.Kind, cmd.Right)
+	if err != nil {
+		return cmd, problem.New(http.StatusBadRequest, problem.ValidationFailed, err.Error())
+	}
+	cmd.Right = right
+	return cmd, nil
+}
+
+// CommandStatus reports the published right and, if one matches, its role
+type CommandStatus struct {
+	Status string `json:"status"`
+	Right  string `json:"right,omitempty"`
+	Role   string `json:"role,omitempty"`
+}
+
+func sendCommandOk(res http.ResponseWriter, cmd PermCommandMsg) {
+	status := CommandStatus{Status: "ok"}
+	if cmd.Command == model.CommandPut {
+		status.Right = model.NormalizeRight(cmd.Right)
+		status.Role = GetRoles().NameOf(cmd.Kind, cmd.Right)
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(status)
+}
+
+// principalRoles maps users or groups to the names of their roles, principals without matching role are omitted
+func principalRoles(kind string, rights map[string]string) map[string]string {
+	result := map[string]string{}
+	for principal, right := range rights {
+		if role := GetRoles().NameOf(kind, right); role != "" {
+			result[principal] = role
+		}
+	}
+	return result
+}
+
+func handleListRoles(res http.ResponseWriter, r *http.Request) {
+	result := map[string][]roles.Role{}
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		result[kind] = GetRoles().Of(kind)
+	} else {
+		for kind := range GetRoles() {
+			result[kind] = GetRoles().Of(kind)
+		}
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(result)
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package roles maps named roles like viewer or owner to the right strings of permission commands.
+package roles
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+)
+
+// DefaultKind holds the roles of every kind; entries of a kind override roles of the same name
+const DefaultKind = "*"
+
+// nameChars are the characters of role names, usable as path segment
+const nameChars = "[A-Za-z0-9_.-]"
+
+// NamePattern restricts role names to characters usable as path segment
+const NamePattern = "^" + nameChars + "+$"
+
+// OptionalNamePattern is NamePattern accepting the empty string, which as right removes a grantee
+const OptionalNamePattern = "^" + nameChars + "*$"
+
+// RightPattern matches non-empty right strings, see IsRight
+const RightPattern = "^[rwxa]+$"
+
+var ErrUnknownRole = errors.New("unknown role")
+
+var namePattern = regexp.MustCompile(NamePattern)
+
+// Config maps resource kinds to role names to right strings
+type Config map[string]map[string]string
+
+type Role struct {
+	Name  string `json:"name"`
+	Right string `json:"right"`
+}
+
+// DefaultConfig defines viewer, executor, editor and owner for every kind
+func DefaultConfig() Config {
+	return Config{DefaultKind: {
+		"viewer":   "r",
+		"executor": "rx",
+		"editor":   "rwx",
+		"owner":    "rwxa",
+	}}
+}
+
+// Validate rejects role names which could be read as right string and rights containing other letters than r, w, x and a
+func (this Config) Validate() error {
+	for kind, roles := range this {
+		for name, right := range roles {
+			if IsRight(name) || !namePattern.MatchString(name) {
+				return fmt.Errorf("roles of %v: invalid role name %q", kind, name)
+			}
+			if right == "" || !IsRight(right) {
+				return fmt.Errorf("roles of %v: invalid right %q of role %v", kind, right, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Of returns the roles of a kind sorted by name
+func (this Config) Of(kind string) (result []Role) {
+	merged := map[string]string{}
+	for name, right := range this[DefaultKind] {
+		merged[name] = right
+	}
+	for name, right := range this[kind] {
+		merged[name] = right
+	}
+	for name, right := range merged {
+		result = append(result, Role{Name: name, Right: model.NormalizeRight(right)})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Expand returns right unchanged if it is a right string and else the right of the role with that name
+func (this Config) Expand(kind string, right string) (string, error) {
+	if IsRight(right) {
+		return right, nil
+	}
+	for _, role := range this.Of(kind) {
+		if role.Name == right {
+			return role.Right, nil
+		}
+	}
+	return "", fmt.Errorf("%w %v for kind %v", ErrUnknownRole, right, kind)
+}
+
+// NameOf returns the first role, by name, with exactly the given right or an empty string.
+// Roles of the kind are preferred over those of DefaultKind.
+func (this Config) NameOf(kind string, right string) string {
+	right = model.NormalizeRight(right)
+	for _, role := range append(Config{kind: this[kind]}.Of(kind), this.Of(kind)...) {
+		if role.Right == right {
+			return role.Name
+		}
+	}
+	return ""
+}
+
+// IsRight is true for strings consisting of r, w, x and a only; the empty right is a right too
+func IsRight(s string) bool {
+	return strings.Trim(s, "rwxa") == ""
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package roles
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	config := Config{
+		DefaultKind: {"viewer": "r", "owner": "axwr"},
+		"devices":   {"viewer": "rx", "operator": "rwx"},
+	}
+	cases := map[string]struct {
+		kind     string
+		right    string
+		expected string
+	}{
+		"right":            {"devices", "rw", "rw"},
+		"empty right":      {"devices", "", ""},
+		"kind role":        {"devices", "operator", "rwx"},
+		"overridden role":  {"devices", "viewer", "rx"},
+		"default role":     {"hubs", "viewer", "r"},
+		"normalized right": {"devices", "owner", "rwxa"},
+	}
+	for name, c := range cases {
+		actual, err := config.Expand(c.kind, c.right)
+		if err != nil || actual != c.expected {
+			t.Errorf("%v: expected %v, got %v %v", name, c.expected, actual, err)
+		}
+	}
+	_, err := config.Expand("hubs", "operator")
+	if !errors.Is(err, ErrUnknownRole) {
+		t.Error("expected roles of other kinds to be unknown, got", err)
+	}
+}
+
+func TestNameOf(t *testing.T) {
+	config := Config{
+		DefaultKind: {"viewer": "r", "editor": "rwx"},
+		"devices":   {"reader": "r"},
+	}
+	if name := config.NameOf("devices", "r"); name != "reader" {
+		t.Error("expected role of the kind to be preferred, got", name)
+	}
+	if name := config.NameOf("hubs", "xwr"); name != "editor" {
+		t.Error("expected editor, got", name)
+	}
+	if name := config.NameOf("hubs", "rx"); name != "" {
+		t.Error("expected no role, got", name)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Error(err)
+	}
+	invalid := map[string]Config{
+		"name is right":   {DefaultKind: {"rwx": "rwx"}},
+		"name with slash": {DefaultKind: {"a/b": "r"}},
+		"empty name":      {DefaultKind: {"": "r"}},
+		"empty right":     {"devices": {"none": ""}},
+		"unknown right":   {"devices": {"reader": "rd"}},
+	}
+	for name, config := range invalid {
+		if err := config.Validate(); err == nil {
+			t.Errorf("%v: expected invalid configuration", name)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/idempotency"
+	"github.com/SENERGY-Platform/permission-command/lib/openapi"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DocumentedRouter only accepts routes together with their openapi operation,
+// so the document served at /openapi.json can not drift from the registered routes.
+// Every request is validated against its operation before the handler is called.
+type DocumentedRouter struct {
+	router      *httprouter.Router
+	doc         *openapi.Document
+	idempotency *idempotency.Handler
+	maxBodySize int64
+	routes      []Route
+}
+
+// Route is a registered method and httprouter path
+type Route struct {
+	Method string
+	Path   string
+}
+
+func NewDocumentedRouter() *DocumentedRouter {
+	router := httprouter.New()
+	router.NotFound = problem.NotFoundHandler()
+	router.MethodNotAllowed = problem.MethodNotAllowedHandler()
+	result := &DocumentedRouter{router: router, doc: newApiDocument()}
+	result.GET("/openapi.json", &openapi.Operation{
+		OperationId: "getOpenApi",
+		Summary:     "openapi 3 description of this api",
+		Tags:        []string{"meta"},
+		Security:    []map[string][]string{},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "openapi document", Content: openapi.JsonContent(&openapi.Schema{Type: "object"})},
+		},
+	}, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(result.doc)
+	})
+	return result
+}
+
+// UseIdempotency accepts the Idempotency-Key header on every POST, PUT and DELETE route registered afterwards,
+// except routes with streamed request body, which would have to be buffered to be compared
+func (this *DocumentedRouter) UseIdempotency(handler *idempotency.Handler) {
+	this.idempotency = handler
+}
+
+// LimitBodySize answers requests with bodies larger than maxBodySize bytes with 413 on every route registered afterwards,
+// except routes with streamed request body; 0 for no limit
+func (this *DocumentedRouter) LimitBodySize(maxBodySize int64) {
+	this.maxBodySize = maxBodySize
+}
+
+func (this *DocumentedRouter) Handle(method string, path string, op *openapi.Operation, handle httprouter.Handle) {
+	streamed := op.RequestBody != nil && op.RequestBody.Streamed
+	idempotent := this.idempotency != nil && method != http.MethodGet && !streamed
+	if idempotent {
+		op.Parameters = append(op.Parameters, idempotencyKeyParam)
+		for status, response := range responses(nil, http.StatusConflict, http.StatusUnprocessableEntity) {
+			if _, ok := op.Responses[status]; !ok && response != nil {
+				op.Responses[status] = response
+			}
+		}
+		handle = this.withIdempotency(handle)
+	}
+	limited := this.maxBodySize > 0 && op.RequestBody != nil && !streamed
+	if limited {
+		if _, ok := op.Responses["413"]; !ok {
+			op.Responses["413"] = responses(nil, http.StatusRequestEntityTooLarge)["413"]
+		}
+	}
+	this.routes = append(this.routes, Route{Method: method, Path: path})
+	err := this.doc.Add(method, path, op)
+	if err != nil {
+		log.Fatal("ERROR: invalid api documentation: ", err)
+	}
+	this.router.Handle(method, path, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		params := map[string]string{}
+		for _, p := range ps {
+			params[p.Key] = p.Value
+		}
+		if limited && r.Body != nil {
+			r.Body = http.MaxBytesReader(res, r.Body, this.maxBodySize)
+		}
+		err := this.doc.ValidateRequest(op, r, params)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.WriteBodyError(res, r, err)
+			return
+		}
+		if err != nil {
+			problem.Write(res, r, http.StatusBadRequest, problem.ValidationFailed, err.Error())
+			return
+		}
+		handle(res, r, ps)
+	})
+}
+
+// withIdempotency scopes idempotency keys to the user of the request token
+func (this *DocumentedRouter) withIdempotency(handle httprouter.Handle) httprouter.Handle {
+	return func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		this.idempotency.Wrap(func(r *http.Request) string {
+			token, err := auth.GetParsedToken(r)
+			if err != nil {
+				return ""
+			}
+			if GetTenants() != nil {
+				return token.Issuer + " " + token.GetUserId()
+			}
+			return token.GetUserId()
+		}, func(res http.ResponseWriter, r *http.Request) {
+			handle(res, r, ps)
+		})(res, r)
+	}
+}
+
+func (this *DocumentedRouter) GET(path string, op *openapi.Operation, handle httprouter.Handle) {
+	this.Handle(http.MethodGet, path, op, handle)
+}
+
+func (this *DocumentedRouter) POST(path string, op *openapi.Operation, handle httprouter.Handle) {
+	this.Handle(http.MethodPost, path, op, handle)
+}
+
+func (this *DocumentedRouter) PUT(path string, op *openapi.Operation, handle httprouter.Handle) {
+	this.Handle(http.MethodPut, path, op, handle)
+}
+
+func (this *DocumentedRouter) DELETE(path string, op *openapi.Operation, handle httprouter.Handle) {
+	this.Handle(http.MethodDelete, path, op, handle)
+}
+
+func (this *DocumentedRouter) Document() *openapi.Document {
+	return this.doc
+}
+
+// Routes returns every registered route in registration order
+func (this *DocumentedRouter) Routes() []Route {
+	return this.routes
+}
+
+// Lookup reports if the router has a handle for the method and request path
+func (this *DocumentedRouter) Lookup(method string, path string) bool {
+	handle, _, _ := this.router.Lookup(method, path)
+	return handle != nil
+}
+
+func (this *DocumentedRouter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	this.router.ServeHTTP(res, req)
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/openapi"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	err := LoadConfig("../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := getRoutes(getIdempotencyHandler())
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if res.Code != http.StatusOK {
+		t.Fatal("unable to read /openapi.json", res.Code, res.Body.String())
+	}
+	doc := struct {
+		Paths map[string]map[string]struct {
+			OperationId string `json:"operationId"`
+		} `json:"paths"`
+	}{}
+	err = json.Unmarshal(res.Body.Bytes(), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(router.Routes()) < 2 {
+		t.Fatal("expected registered routes, got", router.Routes())
+	}
+	for _, route := range router.Routes() {
+		op, ok := doc.Paths[openapi.PathFromRouter(route.Path)][strings.ToLower(route.Method)]
+		if !ok || op.OperationId == "" {
+			t.Errorf("%v %v is registered without operation in /openapi.json", route.Method, route.Path)
+		}
+	}
+
+	pathParam := regexp.MustCompile(`\{[^}]+\}`)
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			if !router.Lookup(strings.ToUpper(method), pathParam.ReplaceAllString(path, "x")) {
+				t.Errorf("%v %v is documented but not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestLargeBodiesAreRejected(t *testing.T) {
+	router := NewDocumentedRouter()
+	router.LimitBodySize(16)
+	called := false
+	op := &openapi.Operation{
+		OperationId: "echo",
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.JsonContent(&openapi.Schema{Type: "object"})},
+		Responses:   responses(statusOk),
+	}
+	router.POST("/echo", op, func(res http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		called = true
+	})
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"value": "`+strings.Repeat("x", 32)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(res, req)
+	if res.Code != http.StatusRequestEntityTooLarge || !strings.Contains(res.Body.String(), string(problem.BodyTooLarge)) {
+		t.Error("expected 413, got", res.Code, res.Body.String())
+	}
+	if called {
+		t.Error("expected handler not to be called")
+	}
+	if _, ok := op.Responses["413"]; !ok {
+		t.Error("expected 413 response to be documented")
+	}
+
+	res = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"value": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !called {
+		t.Error("expected small body to be accepted, got", res.Code, res.Body.String())
+	}
+}
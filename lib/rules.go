@@ -0,0 +1,129 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/policy"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/projection"
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
+)
+
+// CheckCommand evaluates the policy rules every permission command has to follow,
+// independent of the administration right of the requesting user on the resource
+func CheckCommand(token auth.Token, cmd PermCommandMsg) error {
+	t, err := getTenant(token)
+	if err != nil {
+		return err
+	}
+	return checkPolicy(t, policy.Request{UserId: token.GetUserId(), IsAdmin: isAdmin(token), Command: cmd})
+}
+
+// checkPolicy evaluates the policy of the tenant; the current rights are read from the local projection, if it runs
+func checkPolicy(t tenant.Tenant, request policy.Request) error {
+	cmd := request.Command
+	if localProjection != nil {
+		request.Current = func() (projection.Resource, error) {
+			err := requireDefaultTopicsOf(t)
+			if err != nil {
+				return projection.Resource{}, err
+			}
+			p, err := getSyncedProjection()
+			if err != nil {
+				return projection.Resource{}, err
+			}
+			resource, _ := p.Get(cmd.Kind, cmd.Resource)
+			return resource, nil
+		}
+	}
+	err := getPolicyOf(t).Evaluate(request)
+	var p problem.Problem
+	if errors.As(err, &p) && p.Rule != "" {
+		log.Println("WARNING: command rejected by policy rule", p.Rule, p.Detail)
+	}
+	return err
+}
+
+// GetPolicy returns the policy engine of Config.Policy or, if not configured, of policy.DefaultConfig
+func GetPolicy() *policy.Engine {
+	policyOnce.Do(func() {
+		config := policy.DefaultConfig()
+		if Config != nil && Config.Policy != nil {
+			config = *Config.Policy
+		}
+		policyEngine = policy.New(config)
+	})
+	return policyEngine
+}
+
+var policyEngine *policy.Engine
+var policyOnce sync.Once
+
+// AuthorizeCommand checks if the requesting user may administrate the resource of the command
+func AuthorizeCommand(token auth.Token, cmd PermCommandMsg) error {
+	err := authorize(GetAuthorizer(), token, cmd)
+	if errors.Is(err, ErrAccessDenied) {
+		return problem.New(http.StatusForbidden, problem.NotResourceAdmin, "missing administration right for "+cmd.Kind+" "+cmd.Resource)
+	}
+	var p problem.Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	if err != nil {
+		return problem.Wrap(http.StatusBadGateway, problem.PermissionCheckFailed, err)
+	}
+	return nil
+}
+
+// ValidateModelCommand checks the structure of commands which do not originate from route parameters
+func ValidateModelCommand(cmd model.Command) error {
+	if cmd.Command != model.CommandPut && cmd.Command != model.CommandDelete {
+		return problem.New(http.StatusBadRequest, problem.ValidationFailed, "command must be PUT or DELETE")
+	}
+	if cmd.Kind == "" || cmd.Resource == "" {
+		return problem.New(http.StatusBadRequest, problem.ValidationFailed, "kind and resource are required")
+	}
+	if (cmd.User == "") == (cmd.Group == "") {
+		return problem.New(http.StatusBadRequest, problem.ValidationFailed, "exactly one of user and group is required")
+	}
+	if strings.Trim(cmd.Right, "rwxa") != "" {
+		return problem.New(http.StatusBadRequest, problem.ValidationFailed, "right may only contain r, w, x and a")
+	}
+	return nil
+}
+
+func CommandFromModel(cmd model.Command) PermCommandMsg {
+	result := PermCommandMsg{
+		Command:  cmd.Command,
+		Kind:     cmd.Kind,
+		Resource: cmd.Resource,
+		User:     cmd.User,
+		Group:    cmd.Group,
+	}
+	if cmd.Command == model.CommandPut {
+		result.Right = cmd.Right
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tenant resolves the tenant (e.g. keycloak realm) of a token by its issuer and holds the settings of each tenant.
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SENERGY-Platform/permission-command/lib/policy"
+)
+
+// DefaultAdminRole is the admin realm role of tenants without AdminRole
+const DefaultAdminRole = "admin"
+
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+type Config struct {
+	Issuer             string         `json:"issuer"`               //iss claim of the tenants tokens, e.g. https://auth.example.com/auth/realms/a
+	JwksUrl            string         `json:"jwks_url"`             //keys verifying the tenants tokens, empty is the keycloak certs endpoint of Issuer
+	PermissionsViewUrl string         `json:"permissions_view_url"` //empty uses the global PermissionsViewUrl
+	Topic              string         `json:"topic"`                //topic of every kind, overrides TopicPrefix
+	TopicPrefix        string         `json:"topic_prefix"`         //prefixed to the topic of each kind
+	AdminRole          string         `json:"admin_role"`           //empty is DefaultAdminRole
+	Policy             *policy.Config `json:"policy"`               //nil uses the global policy
+}
+
+// Tenant is a named Config; the zero value stands for deployments without tenants and uses the global settings
+type Tenant struct {
+	Name string
+	Config
+}
+
+// TopicOf maps the topic of a kind without tenants to the topic of the tenant
+func (this Tenant) TopicOf(topic string) string {
+	if this.Topic != "" {
+		return this.Topic
+	}
+	return this.TopicPrefix + topic
+}
+
+// UsesDefaultTopics is true if the tenant publishes to the topics of deployments without tenants
+func (this Tenant) UsesDefaultTopics() bool {
+	return this.Topic == "" && this.TopicPrefix == ""
+}
+
+func (this Tenant) GetJwksUrl() string {
+	if this.JwksUrl == "" {
+		return strings.TrimSuffix(this.Issuer, "/") + "/protocol/openid-connect/certs"
+	}
+	return this.JwksUrl
+}
+
+func (this Tenant) GetAdminRole() string {
+	if this.AdminRole == "" {
+		return DefaultAdminRole
+	}
+	return this.AdminRole
+}
+
+type Registry struct {
+	byIssuer map[string]Tenant
+	byName   map[string]Tenant
+}
+
+// New checks that issuers are set and unique and that no two tenants publish to the same topic of topics
+func New(tenants map[string]Config, topics []string) (*Registry, error) {
+	result := &Registry{byIssuer: map[string]Tenant{}, byName: map[string]Tenant{}}
+	owners := map[string]string{}
+	for _, name := range sortedNames(tenants) {
+		t := Tenant{Name: name, Config: tenants[name]}
+		if t.Issuer == "" {
+			return nil, fmt.Errorf("tenant %v: missing issuer", name)
+		}
+		if other, ok := result.byIssuer[t.Issuer]; ok {
+			return nil, fmt.Errorf("tenant %v: issuer %v is already used by %v", name, t.Issuer, other.Name)
+		}
+		for _, topic := range topics {
+			topic = t.TopicOf(topic)
+			if owner, ok := owners[topic]; ok && owner != name {
+				return nil, fmt.Errorf("tenant %v: topic %v is already used by %v", name, topic, owner)
+			}
+			owners[topic] = name
+		}
+		result.byIssuer[t.Issuer] = t
+		result.byName[name] = t
+	}
+	return result, nil
+}
+
+// Resolve returns the tenant of a token issuer
+func (this *Registry) Resolve(issuer string) (Tenant, error) {
+	t, ok := this.byIssuer[issuer]
+	if !ok {
+		return t, fmt.Errorf("%w: no tenant for issuer %q", ErrUnknownTenant, issuer)
+	}
+	return t, nil
+}
+
+// Get returns the tenant with the name
+func (this *Registry) Get(name string) (Tenant, error) {
+	t, ok := this.byName[name]
+	if !ok {
+		return t, fmt.Errorf("%w %q", ErrUnknownTenant, name)
+	}
+	return t, nil
+}
+
+// List returns all tenants sorted by name
+func (this *Registry) List() (result []Tenant) {
+	for _, name := range sortedNames(this.byName) {
+		result = append(result, this.byName[name])
+	}
+	return result
+}
+
+func sortedNames[T any](m map[string]T) (result []string) {
+	for name := range m {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/policy"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
+)
+
+// GetTenants returns the tenants of Config.Tenants or nil, if every token is served with the global settings
+func GetTenants() *tenant.Registry {
+	tenantsOnce.Do(func() {
+		if Config == nil || len(Config.Tenants) == 0 {
+			return
+		}
+		registry, err := tenant.New(Config.Tenants, PermTopics())
+		if err != nil {
+			log.Fatal("ERROR: invalid Tenants ", err)
+		}
+		tenantPolicies = map[string]*policy.Engine{}
+		tenantKeys = map[string]*auth.KeySet{}
+		for _, t := range registry.List() {
+			tenantKeys[t.Name] = auth.NewKeySet(t.GetJwksUrl(), &http.Client{Timeout: 10 * time.Second})
+			if t.Policy != nil {
+				tenantPolicies[t.Name] = policy.New(*t.Policy)
+			}
+			log.Println("tenant", t.Name, "issuer", t.Issuer, "topics", tenantTopics(t))
+		}
+		tenantRegistry = registry
+	})
+	return tenantRegistry
+}
+
+var tenantRegistry *tenant.Registry
+var tenantPolicies map[string]*policy.Engine
+var tenantKeys map[string]*auth.KeySet
+var tenantsOnce sync.Once
+
+// getTenant returns the tenant of the token issuer or, without configured tenants, the zero tenant
+func getTenant(token auth.Token) (tenant.Tenant, error) {
+	registry := GetTenants()
+	if registry == nil {
+		return tenant.Tenant{}, nil
+	}
+	t, err := registry.Resolve(token.Issuer)
+	if err != nil {
+		return t, problem.New(http.StatusForbidden, problem.UnknownTenant, err.Error())
+	}
+	return t, nil
+}
+
+// isAdmin checks the admin role of the tenant of the token
+func isAdmin(token auth.Token) bool {
+	t, err := getTenant(token)
+	return err == nil && token.HasRole(t.GetAdminRole())
+}
+
+// requireDefaultTopics rejects tokens of tenants with own topics from features working on the default topics,
+// like the local projection and manifests
+func requireDefaultTopics(token auth.Token) error {
+	t, err := getTenant(token)
+	if err != nil {
+		return err
+	}
+	return requireDefaultTopicsOf(t)
+}
+
+func requireDefaultTopicsOf(t tenant.Tenant) error {
+	if !t.UsesDefaultTopics() {
+		return problem.New(http.StatusForbidden, problem.TenantNotSupported, "not available for tenant "+t.Name+", which uses own topics")
+	}
+	return nil
+}
+
+// getTenantByName returns the tenant stored with approvals and jobs; without configured tenants only the zero tenant exists
+func getTenantByName(name string) (tenant.Tenant, error) {
+	registry := GetTenants()
+	if registry == nil && name == "" {
+		return tenant.Tenant{}, nil
+	}
+	if registry == nil {
+		return tenant.Tenant{}, tenant.ErrUnknownTenant
+	}
+	return registry.Get(name)
+}
+
+// getPolicyOf returns the policy of the tenant or, if it has none, GetPolicy
+func getPolicyOf(t tenant.Tenant) *policy.Engine {
+	if engine, ok := tenantPolicies[t.Name]; ok {
+		return engine
+	}
+	return GetPolicy()
+}
+
+func getPermissionsViewUrl(t tenant.Tenant) string {
+	if t.PermissionsViewUrl != "" {
+		return t.PermissionsViewUrl
+	}
+	return Config.PermissionsViewUrl
+}
+
+func tenantTopics(t tenant.Tenant) (result []string) {
+	for _, topic := range PermTopics() {
+		if topic = t.TopicOf(topic); !slices.Contains(result, topic) {
+			result = append(result, topic)
+		}
+	}
+	return result
+}
+
+// listTenants returns every tenant or, without tenants, the zero tenant
+func listTenants() []tenant.Tenant {
+	if registry := GetTenants(); registry != nil {
+		return registry.List()
+	}
+	return []tenant.Tenant{{}}
+}
+
+// allPermTopics returns PermTopics and the topics of every tenant
+func allPermTopics() []string {
+	result := PermTopics()
+	if registry := GetTenants(); registry != nil {
+		for _, t := range registry.List() {
+			for _, topic := range tenantTopics(t) {
+				if !slices.Contains(result, topic) {
+					result = append(result, topic)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// sendTenantEvent publishes the command to the topic of its kind of the tenant
+func sendTenantEvent(t tenant.Tenant, cmd PermCommandMsg) error {
+	return conn.PublishTo(context.Background(), t.TopicOf(TopicOfKind(cmd.Kind)), cmd)
+}
+
+// TopicForToken returns the topic for commands of kind published on behalf of token
+func TopicForToken(token auth.Token, kind string) (string, error) {
+	t, err := getTenant(token)
+	if err != nil {
+		return "", err
+	}
+	return t.TopicOf(TopicOfKind(kind)), nil
+}
+
+// AnonymousAdmin returns a token without signature holding the admin role of the tenant with the given name,
+// for tools acting with the service configuration instead of a user
+func AnonymousAdmin(sub string, tenantName string) (auth.Token, error) {
+	t, err := getTenantByName(tenantName)
+	if err != nil {
+		return auth.Token{}, fmt.Errorf("%w, use one of the configured tenants", err)
+	}
+	return auth.Token{Sub: sub, Issuer: t.Issuer, RealmAccess: map[string][]string{"roles": {t.GetAdminRole()}}}, nil
+}
+
+// tenantFilter rejects requests with malformed tokens, tokens of unknown issuers and tokens not signed by their tenant
+// before they reach a route
+func tenantFilter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, r *http.Request) {
+		if GetTenants() != nil && auth.GetAuthToken(r) != "" {
+			err := verifyTenantToken(auth.GetAuthToken(r))
+			if err != nil {
+				problem.WriteError(res, r, err)
+				return
+			}
+		}
+		next.ServeHTTP(res, r)
+	})
+}
+
+// verifyTenantToken resolves the tenant by the unverified issuer and checks the signature with the keys of that tenant
+func verifyTenantToken(raw string) error {
+	token, err := auth.Parse(raw)
+	if err != nil {
+		return problem.New(http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
+	}
+	t, err := getTenant(token)
+	if err != nil {
+		return err
+	}
+	err = tenantKeys[t.Name].Verify(raw)
+	if errors.Is(err, auth.ErrKeysUnavailable) {
+		p := problem.Wrap(http.StatusBadGateway, problem.Internal, err)
+		p.Detail = "unable to load the token keys of tenant " + t.Name
+		return p
+	}
+	if err != nil {
+		return problem.New(http.StatusUnauthorized, problem.InvalidToken, "token of tenant "+t.Name+" is not valid: "+err.Error())
+	}
+	return nil
+}
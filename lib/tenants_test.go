@@ -0,0 +1,109 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/permission-command/lib/tenant"
+	"github.com/golang-jwt/jwt"
+)
+
+func setupTenants(t *testing.T, tenants map[string]tenant.Config) {
+	err := LoadConfig("../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Config.Tenants = tenants
+	tenantsOnce = sync.Once{}
+	tenantRegistry = nil
+	t.Cleanup(func() {
+		tenantsOnce = sync.Once{}
+		tenantRegistry = nil
+	})
+}
+
+func TestTenantFilter(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "a",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+	unavailable := httptest.NewServer(http.NotFoundHandler())
+	defer unavailable.Close()
+
+	setupTenants(t, map[string]tenant.Config{
+		"a": {Issuer: "https://auth.example.com/realms/a", JwksUrl: jwks.URL},
+		"b": {Issuer: "https://auth.example.com/realms/b", JwksUrl: unavailable.URL, TopicPrefix: "b-"},
+	})
+
+	sign := func(issuer string, key interface{}) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "u1", "iss": issuer, "exp": time.Now().Add(time.Hour).Unix()})
+		token.Header["kid"] = "a"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + signed
+	}
+	filter := tenantFilter(http.HandlerFunc(func(res http.ResponseWriter, r *http.Request) {
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	for name, c := range map[string]struct {
+		token  string
+		status int
+	}{
+		"valid":         {sign("https://auth.example.com/realms/a", key), http.StatusNoContent},
+		"no token":      {"", http.StatusNoContent},
+		"unparsable":    {"Bearer not-a-jwt", http.StatusUnauthorized},
+		"unknown":       {sign("https://auth.example.com/realms/x", key), http.StatusForbidden},
+		"forged":        {sign("https://auth.example.com/realms/a", otherKey), http.StatusUnauthorized},
+		"no keys":       {sign("https://auth.example.com/realms/b", key), http.StatusBadGateway},
+		"without realm": {sign("", key), http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/roles", nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", c.token)
+		}
+		res := httptest.NewRecorder()
+		filter.ServeHTTP(res, req)
+		if res.Code != c.status {
+			t.Errorf("%v: expected %v, got %v %v", name, c.status, res.Code, res.Body.String())
+		}
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	TopicProvisioningCreate = "create" //create missing topics, verify existing ones
+	TopicProvisioningVerify = "verify" //only verify, missing topics are an error
+	TopicProvisioningSkip   = "skip"   //topics are managed externally
+)
+
+const (
+	TopicMismatchWarn = "warn"
+	TopicMismatchFail = "fail"
+)
+
+// TopicOfKind returns the topic permission commands of the resource kind are published to
+func TopicOfKind(kind string) string {
+	if topic, ok := Config.KindTopics[kind]; ok && topic != "" {
+		return topic
+	}
+	return Config.PermTopic
+}
+
+// PermTopics returns Config.PermTopic and every topic of Config.KindTopics
+func PermTopics() []string {
+	result := []string{Config.PermTopic}
+	for _, kind := range sortedKeys(Config.KindTopics) {
+		topic := Config.KindTopics[kind]
+		if topic != "" && !slices.Contains(result, topic) {
+			result = append(result, topic)
+		}
+	}
+	return result
+}
+
+// InitTopic creates or verifies the topics according to Config.TopicProvisioning
+func InitTopic(bootstrapUrl string, topics ...string) (err error) {
+	switch Config.TopicProvisioning {
+	case TopicProvisioningSkip:
+		return nil
+	case TopicProvisioningCreate, TopicProvisioningVerify:
+	default:
+		return errors.New("unknown TopicProvisioning " + Config.TopicProvisioning)
+	}
+	dialer, err := GetKafkaDialer()
+	if err != nil {
+		return err
+	}
+	conn, err := dialer.Dial("tcp", bootstrapUrl)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	//ReadPartitions with topic names would auto create missing topics on brokers allowing it
+	partitions, err := conn.ReadPartitions()
+	if err != nil {
+		return err
+	}
+	existing := map[string][]kafka.Partition{}
+	for _, partition := range partitions {
+		existing[partition.Topic] = append(existing[partition.Topic], partition)
+	}
+
+	missing := []string{}
+	mismatches := []string{}
+	for _, topic := range topics {
+		if _, ok := existing[topic]; !ok {
+			missing = append(missing, topic)
+			continue
+		}
+		found, err := verifyTopic(bootstrapUrl, topic, existing[topic])
+		if err != nil {
+			return err
+		}
+		mismatches = append(mismatches, found...)
+	}
+	if len(mismatches) > 0 {
+		if Config.TopicMismatch == TopicMismatchFail {
+			return errors.New("topic configuration mismatch: " + strings.Join(mismatches, "; "))
+		}
+		for _, mismatch := range mismatches {
+			log.Println("WARNING: topic configuration mismatch:", mismatch)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if Config.TopicProvisioning == TopicProvisioningVerify {
+		return errors.New("missing topics: " + strings.Join(missing, ", "))
+	}
+	return createTopics(dialer, conn, missing)
+}
+
+func createTopics(dialer *kafka.Dialer, conn *kafka.Conn, topics []string) error {
+	controller, err := conn.Controller()
+	if err != nil {
+		return err
+	}
+	controllerConn, err := dialer.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return err
+	}
+	defer controllerConn.Close()
+
+	configEntries := []kafka.ConfigEntry{}
+	for _, name := range sortedKeys(Config.TopicConfig) {
+		configEntries = append(configEntries, kafka.ConfigEntry{ConfigName: name, ConfigValue: Config.TopicConfig[name]})
+	}
+	topicConfigs := []kafka.TopicConfig{}
+	for _, topic := range topics {
+		log.Println("create topic", topic)
+		topicConfigs = append(topicConfigs, kafka.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     int(Config.TopicPartitions),
+			ReplicationFactor: int(Config.TopicReplicationFactor),
+			ConfigEntries:     configEntries,
+		})
+	}
+	return controllerConn.CreateTopics(topicConfigs...)
+}
+
+// verifyTopic returns a description of every difference between the existing topic and the configuration
+func verifyTopic(bootstrapUrl string, topic string, partitions []kafka.Partition) (mismatches []string, err error) {
+	if len(partitions) != int(Config.TopicPartitions) {
+		mismatches = append(mismatches, topic+": "+strconv.Itoa(len(partitions))+" partitions, expected "+strconv.FormatInt(Config.TopicPartitions, 10))
+	}
+	if len(partitions[0].Replicas) != int(Config.TopicReplicationFactor) {
+		mismatches = append(mismatches, topic+": replication factor "+strconv.Itoa(len(partitions[0].Replicas))+", expected "+strconv.FormatInt(Config.TopicReplicationFactor, 10))
+	}
+	transport, err := kafkaSecurity().Transport()
+	if err != nil {
+		return mismatches, err
+	}
+	client := &kafka.Client{Addr: kafka.TCP(bootstrapUrl), Transport: transport, Timeout: 10 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic,
+			ConfigNames:  sortedKeys(Config.TopicConfig),
+		}},
+	})
+	if err != nil {
+		return mismatches, err
+	}
+	actual := map[string]string{}
+	for _, resource := range resp.Resources {
+		if resource.Error != nil {
+			return mismatches, resource.Error
+		}
+		for _, entry := range resource.ConfigEntries {
+			actual[entry.ConfigName] = entry.ConfigValue
+		}
+	}
+	for _, name := range sortedKeys(Config.TopicConfig) {
+		if actual[name] != Config.TopicConfig[name] {
+			mismatches = append(mismatches, topic+": "+name+"="+actual[name]+", expected "+Config.TopicConfig[name])
+		}
+	}
+	return mismatches, nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	result := []string{}
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
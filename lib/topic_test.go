@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopicRouting(t *testing.T) {
+	old := Config
+	Config = &ConfigStruct{PermTopic: "permissions", KindTopics: map[string]string{
+		"devices":   "device-permissions",
+		"hubs":      "device-permissions",
+		"processes": "",
+		"imports":   "import-permissions",
+	}}
+	t.Cleanup(func() {
+		Config = old
+	})
+	cases := map[string]string{
+		"devices":   "device-permissions",
+		"hubs":      "device-permissions",
+		"processes": "permissions",
+		"groups":    "permissions",
+	}
+	for kind, expected := range cases {
+		if actual := TopicOfKind(kind); actual != expected {
+			t.Errorf("%v: expected %v, got %v", kind, expected, actual)
+		}
+	}
+	expected := []string{"permissions", "device-permissions", "import-permissions"}
+	if actual := PermTopics(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestInitTopicProvisioning(t *testing.T) {
+	old := Config
+	t.Cleanup(func() {
+		Config = old
+	})
+	Config = &ConfigStruct{TopicProvisioning: TopicProvisioningSkip}
+	if err := InitTopic("unreachable:9092", "permissions"); err != nil {
+		t.Error("expected skipped provisioning not to connect, got", err)
+	}
+	Config = &ConfigStruct{TopicProvisioning: "delete"}
+	if err := InitTopic("unreachable:9092", "permissions"); err == nil {
+		t.Error("expected unknown provisioning to be rejected")
+	}
+}
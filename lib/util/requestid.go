@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+type requestIdKey struct{}
+
+func NewRequestId(handler http.Handler) *RequestIdMiddleware {
+	return &RequestIdMiddleware{handler: handler}
+}
+
+// RequestIdMiddleware reuses the X-Request-Id header of incoming requests or generates a new id,
+// echoes it in the response and makes it available to handlers via GetRequestId
+type RequestIdMiddleware struct {
+	handler http.Handler
+}
+
+func (this *RequestIdMiddleware) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	id := req.Header.Get(RequestIdHeader)
+	if id == "" {
+		id = newRequestId()
+	}
+	res.Header().Set(RequestIdHeader, id)
+	this.handler.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), requestIdKey{}, id)))
+}
+
+func GetRequestId(req *http.Request) string {
+	id, ok := req.Context().Value(requestIdKey{}).(string)
+	if !ok {
+		return req.Header.Get(RequestIdHeader)
+	}
+	return id
+}
+
+func newRequestId() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
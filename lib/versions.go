@@ -0,0 +1,155 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/SENERGY-Platform/permission-command/lib/auth"
+	"github.com/SENERGY-Platform/permission-command/lib/problem"
+	"github.com/SENERGY-Platform/permission-command/lib/projection"
+)
+
+type resourceKey struct {
+	kind string
+	id   string
+}
+
+// pendingVersions holds the version each If-Match write was checked against, until the projection applied the write.
+// A concurrent write based on the same version fails, although the projection still reports it as current.
+var pendingVersions = map[resourceKey]string{}
+var pendingVersionsMux sync.Mutex
+
+func etag(version string) string {
+	return `"` + version + `"`
+}
+
+// ifMatches reports if the If-Match header value matches the resource version; "*" matches every existing resource
+func ifMatches(header string, resource projection.Resource, found bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if (tag == "*" && found) || tag == etag(resource.Version()) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch returns 412 if the If-Match header of the request does not match the current version of the resource.
+// Without If-Match header nothing is checked. Callers have to call done with the result of publishing.
+func checkIfMatch(r *http.Request, token auth.Token, kind string, id string) (done func(published bool), err error) {
+	return checkVersion(r.Header.Get("If-Match"), token, kind, id)
+}
+
+// checkVersion is checkIfMatch for an If-Match header value, e.g. the one stored with a pending change
+func checkVersion(header string, token auth.Token, kind string, id string) (done func(published bool), err error) {
+	if header == "" {
+		return func(bool) {}, nil
+	}
+	err = requireDefaultTopics(token)
+	if err != nil {
+		return nil, err
+	}
+	p, err := getSyncedProjection()
+	if err != nil {
+		return nil, err
+	}
+	pendingVersionsMux.Lock()
+	defer pendingVersionsMux.Unlock()
+	evictAppliedVersions(p)
+	key := resourceKey{kind: kind, id: id}
+	resource, found := p.Get(kind, id)
+	version := resource.Version()
+	if pendingVersions[key] == version {
+		return nil, problem.New(http.StatusPreconditionFailed, problem.VersionMismatch, "a concurrent change of "+kind+" "+id+" is not applied yet")
+	}
+	if !ifMatches(header, resource, found) {
+		return nil, problem.New(http.StatusPreconditionFailed, problem.VersionMismatch, "current version of "+kind+" "+id+" is "+etag(version))
+	}
+	pendingVersions[key] = version
+	return func(published bool) {
+		if published {
+			return
+		}
+		pendingVersionsMux.Lock()
+		defer pendingVersionsMux.Unlock()
+		if pendingVersions[key] == version {
+			delete(pendingVersions, key)
+		}
+	}, nil
+}
+
+// evictAppliedVersions removes the pending versions of resources whose version changed since, because the projection
+// applied the write; pendingVersionsMux has to be locked
+func evictAppliedVersions(p *projection.Projection) {
+	for key, pending := range pendingVersions {
+		resource, _ := p.Get(key.kind, key.id)
+		if resource.Version() != pending {
+			delete(pendingVersions, key)
+		}
+	}
+}
+
+// handleGetResource returns the rights of the resource with its version as ETag
+func handleGetResource(res http.ResponseWriter, r *http.Request, kind string, id string) {
+	token, err := auth.GetParsedToken(r)
+	if err != nil {
+		problem.Write(res, r, http.StatusUnauthorized, problem.InvalidToken, "missing or malformed authorization token")
+		return
+	}
+	err = requireDefaultTopics(token)
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	err = AuthorizeCommand(token, PermCommandMsg{Kind: kind, Resource: id})
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	p, err := getSyncedProjection()
+	if err != nil {
+		problem.WriteError(res, r, err)
+		return
+	}
+	resource, _ := p.Get(kind, id)
+	tag := etag(resource.Version())
+	res.Header().Set("ETag", tag)
+	if r.Header.Get("If-None-Match") == tag {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(ResourceRights{
+		Users:      resource.Users,
+		Groups:     resource.Groups,
+		UserRoles:  principalRoles(kind, resource.Users),
+		GroupRoles: principalRoles(kind, resource.Groups),
+		Version:    resource.Version(),
+	})
+}
+
+type ResourceRights struct {
+	Users      map[string]string `json:"users"`
+	Groups     map[string]string `json:"groups"`
+	UserRoles  map[string]string `json:"user_roles"`
+	GroupRoles map[string]string `json:"group_roles"`
+	Version    string            `json:"version"`
+}
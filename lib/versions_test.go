@@ -0,0 +1,47 @@
+/*
+ * Copyright 2024 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package lib
+
+import (
+	"testing"
+
+	"github.com/SENERGY-Platform/permission-command/lib/model"
+	"github.com/SENERGY-Platform/permission-command/lib/projection"
+)
+
+func TestAppliedVersionsAreEvicted(t *testing.T) {
+	p := projection.New()
+	p.Apply("permissions", 0, 1, model.PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d1", User: "u1", Right: "rx"})
+	p.Apply("permissions", 0, 2, model.PermCommandMsg{Command: model.CommandPut, Kind: "devices", Resource: "d2", User: "u1", Right: "rx"})
+	d1, _ := p.Get("devices", "d1")
+	d2, _ := p.Get("devices", "d2")
+	pendingVersions = map[resourceKey]string{
+		{kind: "devices", id: "d1"}: d1.Version(),
+		{kind: "devices", id: "d2"}: d2.Version(),
+	}
+	t.Cleanup(func() {
+		pendingVersions = map[resourceKey]string{}
+	})
+
+	p.Apply("permissions", 0, 3, model.PermCommandMsg{Command: model.CommandDelete, Kind: "devices", Resource: "d1", User: "u1"})
+	evictAppliedVersions(p)
+	if _, ok := pendingVersions[resourceKey{kind: "devices", id: "d1"}]; ok {
+		t.Error("expected applied write of d1 to be evicted")
+	}
+	if _, ok := pendingVersions[resourceKey{kind: "devices", id: "d2"}]; !ok {
+		t.Error("expected pending write of d2 to be kept")
+	}
+}
@@ -35,6 +35,14 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if flag.Arg(0) == "reconcile" {
+		err = lib.RunReconcileCommand(flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	go lib.StartApi()
 
 	shutdown := make(chan os.Signal, 1)